@@ -0,0 +1,301 @@
+package q
+
+import (
+	"math/rand"
+
+	"github.com/axamon/q/density"
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/qubit"
+)
+
+// Backend is the representation of the register that Q evolves,
+// the state vector by default. The qbits are given by their positions,
+// the first qbit being the most significant bit of the matrices.
+// It is selected by WithBackend.
+type Backend interface {
+	// Add appends a qbit of the amplitudes, or returns an error
+	// if the backend cannot represent it.
+	Add(z ...complex128) error
+
+	// NumberOfBit returns the number of qbits.
+	NumberOfBit() int
+
+	// ApplyAt applies the 2x2 matrix to the target when the controls are |1>.
+	ApplyAt(u matrix.Matrix, target int, control ...int)
+
+	// ApplyControlled applies the 2^k x 2^k matrix to the k targets
+	// when the controls are |1> and the open controls |0>.
+	ApplyControlled(u matrix.Matrix, control, open []int, target ...int)
+
+	// ApplyKraus applies one of the Kraus operators to the target
+	// with its probability.
+	ApplyKraus(k []matrix.Matrix, target int)
+
+	// Swap swaps two qbits.
+	Swap(b0, b1 int)
+
+	// Measure measures the qbit and returns true if it is |1>.
+	Measure(bit int) bool
+
+	// Probability returns the probability of each basis state.
+	Probability() []float64
+
+	// DensityMatrix returns the density matrix of the register.
+	DensityMatrix() *density.Matrix
+
+	// Clone returns a copy that evolves on its own.
+	Clone() Backend
+
+	// Release traces out the qbit.
+	Release(bit int) error
+
+	// Expectation returns the expectation value of the product
+	// of the matrices, each on its own targets.
+	Expectation(u []matrix.Matrix, target [][]int) complex128
+
+	// Rand sets the source of the random numbers, nil for the global one.
+	Rand(src rand.Source)
+}
+
+// Validator is a Backend that cannot apply every instruction,
+// such as the stabilizer tableau.
+type Validator interface {
+	// Validate returns an error if the instruction,
+	// on the positions of the qbits, cannot be applied.
+	Validate(in Instruction) error
+}
+
+// NewStateVector returns the default Backend, a pure state vector.
+func NewStateVector() Backend {
+	return &vector{}
+}
+
+// NewDensityMatrix returns the Backend of a density matrix,
+// which represents mixed states.
+func NewDensityMatrix() Backend {
+	return &mixed{}
+}
+
+// NewStabilizer returns the Backend of a stabilizer tableau.
+// See WithStabilizer.
+func NewStabilizer() Backend {
+	return &stabilizer{}
+}
+
+// NewMPS returns the Backend of a matrix product state. See WithMPS.
+func NewMPS(maxBond int, threshold float64) Backend {
+	return &mps{maxBond: maxBond, threshold: threshold}
+}
+
+// sampler is a Backend that samples measurements of all the qbits
+// without computing the probabilities of the basis states.
+type sampler interface {
+	// sample returns the bits of each shot by position.
+	sample(shots int) [][]bool
+}
+
+// concurrent is a Backend whose loops run on several goroutines.
+type concurrent interface {
+	// setWorkers sets the number of goroutines, 0 for one per CPU.
+	setWorkers(n int)
+}
+
+// vector is the pure state vector.
+type vector struct {
+	qubit   *qubit.Qubit
+	src     rand.Source
+	workers int
+}
+
+func (s *vector) Add(z ...complex128) error {
+	if s.qubit == nil {
+		s.qubit = qubit.New(z...).Rand(s.src).Workers(s.workers)
+		return nil
+	}
+
+	s.qubit.TensorProduct(qubit.New(z...))
+	return nil
+}
+
+func (s *vector) NumberOfBit() int {
+	if s.qubit == nil {
+		return 0
+	}
+
+	return s.qubit.NumberOfBit()
+}
+
+func (s *vector) ApplyAt(u matrix.Matrix, target int, control ...int) {
+	s.qubit.ApplyAt(u, target, control...)
+}
+
+func (s *vector) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) {
+	if len(target) == 1 && len(open) == 0 {
+		s.qubit.ApplyAt(u, target[0], control...)
+		return
+	}
+
+	s.qubit.ApplyControlled(u, control, open, target...)
+}
+
+func (s *vector) ApplyKraus(k []matrix.Matrix, target int) {
+	s.qubit.ApplyKraus(k, target)
+}
+
+func (s *vector) Swap(b0, b1 int) {
+	s.qubit.Swap(b0, b1)
+}
+
+func (s *vector) Measure(bit int) bool {
+	return s.qubit.MeasureAt(bit).IsOne()
+}
+
+func (s *vector) Probability() []float64 {
+	return s.qubit.Probability()
+}
+
+func (s *vector) DensityMatrix() *density.Matrix {
+	return density.Pure(s.qubit)
+}
+
+func (s *vector) Clone() Backend {
+	return &vector{s.qubit.Clone(), s.src, s.workers}
+}
+
+func (s *vector) Release(bit int) error {
+	if s.NumberOfBit() == 1 {
+		s.qubit = nil
+		return nil
+	}
+
+	r, err := s.qubit.PartialTrace(bit)
+	if err != nil {
+		return err
+	}
+
+	s.qubit = r
+	return nil
+}
+
+func (s *vector) Expectation(u []matrix.Matrix, target [][]int) complex128 {
+	if len(u) == 1 {
+		return s.qubit.Expectation(u[0], target[0]...)
+	}
+
+	// the product applied one matrix at a time
+	c := s.qubit.Clone()
+	for i := range u {
+		c.ApplyControlled(u[i], nil, nil, target[i]...)
+	}
+
+	return c.InnerProduct(s.qubit)
+}
+
+func (s *vector) Rand(src rand.Source) {
+	s.src = src
+	if s.qubit != nil {
+		s.qubit.Rand(src)
+	}
+}
+
+func (s *vector) setWorkers(n int) {
+	s.workers = n
+	if s.qubit != nil {
+		s.qubit.Workers(n)
+	}
+}
+
+// mixed is the density matrix of a mixed state.
+type mixed struct {
+	rho     *density.Matrix
+	src     rand.Source
+	workers int
+}
+
+func (s *mixed) Add(z ...complex128) error {
+	if s.rho == nil {
+		s.rho = density.New(z...).Rand(s.src).Workers(s.workers)
+		return nil
+	}
+
+	s.rho.TensorProduct(density.New(z...))
+	return nil
+}
+
+func (s *mixed) NumberOfBit() int {
+	if s.rho == nil {
+		return 0
+	}
+
+	return s.rho.NumberOfBit()
+}
+
+func (s *mixed) ApplyAt(u matrix.Matrix, target int, control ...int) {
+	s.rho.ApplyAt(u, target, control...)
+}
+
+func (s *mixed) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) {
+	if len(target) == 1 && len(open) == 0 {
+		s.rho.ApplyAt(u, target[0], control...)
+		return
+	}
+
+	s.rho.ApplyControlled(u, control, open, target...)
+}
+
+func (s *mixed) ApplyKraus(k []matrix.Matrix, target int) {
+	s.rho.ApplyKraus(k, target)
+}
+
+func (s *mixed) Swap(b0, b1 int) {
+	s.rho.Swap(b0, b1)
+}
+
+func (s *mixed) Measure(bit int) bool {
+	return s.rho.MeasureAt(bit).IsOne()
+}
+
+func (s *mixed) Probability() []float64 {
+	return s.rho.Probability()
+}
+
+func (s *mixed) DensityMatrix() *density.Matrix {
+	return s.rho.Clone()
+}
+
+func (s *mixed) Clone() Backend {
+	return &mixed{s.rho.Clone(), s.src, s.workers}
+}
+
+func (s *mixed) Release(bit int) error {
+	if s.NumberOfBit() == 1 {
+		s.rho = nil
+		return nil
+	}
+
+	s.rho = s.rho.PartialTrace(bit).Rand(s.src).Workers(s.workers)
+	return nil
+}
+
+func (s *mixed) Expectation(u []matrix.Matrix, target [][]int) complex128 {
+	t := []int{}
+	for i := range target {
+		t = append(t, target[i]...)
+	}
+
+	return s.rho.Expectation(matrix.TensorProduct(u...), t...)
+}
+
+func (s *mixed) Rand(src rand.Source) {
+	s.src = src
+	if s.rho != nil {
+		s.rho.Rand(src)
+	}
+}
+
+func (s *mixed) setWorkers(n int) {
+	s.workers = n
+	if s.rho != nil {
+		s.rho.Workers(n)
+	}
+}
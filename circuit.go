@@ -0,0 +1,325 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+)
+
+var (
+	// ErrUnknownInstruction is returned when the name of the instruction is not known.
+	ErrUnknownInstruction = errors.New("q: unknown instruction")
+
+	// ErrNotInvertible is returned when the circuit has measurements or channels.
+	ErrNotInvertible = errors.New("q: circuit is not invertible")
+)
+
+// Instruction is an operation of a circuit.
+type Instruction struct {
+	// Name is the name of the operation:
+	// "h", "x", "y", "z", "s", "sdg", "t", "tdg", "r", "rx", "ry", "rz",
+	// "p", "u3", "u", "unitary",
+	// "swap", "qft", "iqft", "kraus", "measure", "reset" or "barrier".
+	// Any other name is a gate given by Matrix.
+	Name string
+
+	// Params are the parameters of the gate, e.g. k of "r"
+	// or theta, phi and lambda of "u3".
+	Params []float64
+
+	// Symbols are the symbolic parameters. If Symbols[i] has a name,
+	// Params[i] is its value once the instruction is bound.
+	Symbols []Param
+
+	// Target are the indices of the qbits the operation acts on.
+	Target []int
+
+	// Control are the indices of the qbits controlling the gate.
+	Control []int
+
+	// Open are the indices of the qbits controlling the gate when they are |0>.
+	Open []int
+
+	// Matrix is the matrix of "unitary" and of the gates the circuit
+	// does not know by name, e.g. "u2" of OpenQASM. A 2x2 matrix
+	// acts on each target, a 2^k x 2^k matrix on the k targets together.
+	Matrix matrix.Matrix
+
+	// Kraus are the Kraus operators of "kraus".
+	Kraus []matrix.Matrix
+
+	// Clbit are the classical bits the results of "measure" are written to.
+	Clbit []int
+
+	// Condition applies the operation only if the classical bits hold the value.
+	Condition *Condition
+}
+
+// Condition compares classical bits with a value.
+type Condition struct {
+	// Clbit are the classical bits. Clbit[0] is the least significant bit.
+	Clbit []int
+
+	// Value is the expected value of the classical bits.
+	Value int
+}
+
+// Register is a named group of classical bits.
+type Register struct {
+	Name string
+
+	// Clbit are the classical bits. Clbit[0] is the least significant bit.
+	Clbit []int
+}
+
+// Unitary returns the matrix of the gate, or nil if the instruction
+// is not a gate or has unbound symbolic parameters.
+func (in Instruction) Unitary() matrix.Matrix {
+	if len(in.Symbols) > 0 {
+		return nil
+	}
+
+	switch in.Name {
+	case "h":
+		return gate.H()
+	case "x":
+		return gate.X()
+	case "y":
+		return gate.Y()
+	case "z":
+		return gate.Z()
+	case "s":
+		return gate.S()
+	case "sdg":
+		return gate.S().Dagger()
+	case "t":
+		return gate.T()
+	case "tdg":
+		return gate.T().Dagger()
+	case "r":
+		return gate.R(int(in.Params[0]))
+	case "rx":
+		return gate.RX(in.Params[0])
+	case "ry":
+		return gate.RY(in.Params[0])
+	case "rz":
+		return gate.RZ(in.Params[0])
+	case "p":
+		return gate.Phase(in.Params[0])
+	case "u3":
+		return gate.U3(in.Params[0], in.Params[1], in.Params[2])
+	case "u":
+		return gate.U(in.Params[0], in.Params[1], in.Params[2], in.Params[3])
+	case "swap", "qft", "iqft", "kraus", "measure", "reset", "barrier":
+		return nil
+	}
+
+	return in.Matrix
+}
+
+// Inverse returns the instruction that undoes the instruction.
+func (in Instruction) Inverse() (Instruction, error) {
+	inv := in
+	switch in.Name {
+	case "h", "x", "y", "z", "swap", "barrier":
+	case "s":
+		inv.Name = "sdg"
+	case "sdg":
+		inv.Name = "s"
+	case "t":
+		inv.Name = "tdg"
+	case "tdg":
+		inv.Name = "t"
+	case "r":
+		if len(in.Params) != 1 {
+			return Instruction{}, fmt.Errorf("%w: %v: %d parameters of 1", ErrDimensionMismatch, in.Name, len(in.Params))
+		}
+		inv.Name = "p"
+		inv.Params = []float64{-2 * math.Pi / math.Pow(2, float64(int(in.Params[0])))}
+	case "rx", "ry", "rz", "p":
+		inv = in.negate(0)
+	case "u3":
+		inv = in.negate(0, 2, 1)
+	case "u":
+		inv = in.negate(0, 3, 2, 1)
+	case "qft":
+		inv.Name = "iqft"
+	case "iqft":
+		inv.Name = "qft"
+	case "measure", "reset", "kraus":
+		return Instruction{}, ErrNotInvertible
+	default:
+		u := in.Unitary()
+		if u == nil {
+			return Instruction{}, ErrUnknownInstruction
+		}
+		inv.Name, inv.Params, inv.Matrix = "unitary", nil, u.Dagger()
+	}
+
+	return inv, nil
+}
+
+// negate returns the instruction with the parameters in the order
+// of the indices and of opposite sign.
+func (in Instruction) negate(order ...int) Instruction {
+	neg := in
+	if len(in.Params) > 0 {
+		neg.Params = make([]float64, len(order))
+		for i, j := range order {
+			if j < len(in.Params) {
+				neg.Params[i] = -in.Params[j]
+			}
+		}
+	}
+
+	if len(in.Symbols) > 0 {
+		neg.Symbols = make([]Param, len(order))
+		for i, j := range order {
+			if j < len(in.Symbols) {
+				neg.Symbols[i] = in.Symbols[j].Mul(-1)
+			}
+		}
+	}
+
+	return neg
+}
+
+// String returns the instruction in a readable form such as "x c[0 1] t[2]".
+func (in Instruction) String() string {
+	var b strings.Builder
+	if in.Condition != nil {
+		fmt.Fprintf(&b, "if %v==%d ", in.Condition.Clbit, in.Condition.Value)
+	}
+
+	b.WriteString(in.Name)
+	if len(in.Params) > 0 || len(in.Symbols) > 0 {
+		p := []string{}
+		for i := 0; i < len(in.Params) || i < len(in.Symbols); i++ {
+			switch {
+			case i < len(in.Symbols) && in.Symbols[i].Name != "":
+				p = append(p, in.Symbols[i].String())
+			case i < len(in.Params):
+				p = append(p, fmt.Sprint(in.Params[i]))
+			default:
+				p = append(p, "0")
+			}
+		}
+		fmt.Fprintf(&b, "(%v)", strings.Join(p, " "))
+	}
+
+	if len(in.Control) > 0 {
+		fmt.Fprintf(&b, " c%v", in.Control)
+	}
+
+	if len(in.Open) > 0 {
+		fmt.Fprintf(&b, " o%v", in.Open)
+	}
+
+	fmt.Fprintf(&b, " t%v", in.Target)
+
+	if len(in.Clbit) > 0 {
+		fmt.Fprintf(&b, " -> %v", in.Clbit)
+	}
+
+	return b.String()
+}
+
+// Circuit is a list of instructions on a register.
+type Circuit struct {
+	// Init are the initial amplitudes of each qbit. nil means |0>.
+	Init [][]complex128
+
+	// Clbits is the number of classical bits.
+	Clbits int
+
+	// Registers are the named groups of the classical bits.
+	Registers []Register
+
+	// Instructions are the operations in order of application.
+	Instructions []Instruction
+}
+
+// NewCircuit creates a circuit on a register of the bits initialized to |0>.
+func NewCircuit(bit int) *Circuit {
+	return &Circuit{Init: make([][]complex128, bit)}
+}
+
+// NumberOfBit returns the number of qbits of the register.
+func (c *Circuit) NumberOfBit() int {
+	return len(c.Init)
+}
+
+// Append appends the instructions to the circuit.
+// The register and the classical bits grow to hold the bits they use.
+func (c *Circuit) Append(in ...Instruction) *Circuit {
+	for _, i := range in {
+		for _, b := range append(append(append([]int{}, i.Target...), i.Control...), i.Open...) {
+			for len(c.Init) <= b {
+				c.Init = append(c.Init, nil)
+			}
+		}
+
+		clbit := i.Clbit
+		if i.Condition != nil {
+			clbit = append(append([]int{}, clbit...), i.Condition.Clbit...)
+		}
+
+		for _, b := range clbit {
+			if c.Clbits <= b {
+				c.Clbits = b + 1
+			}
+		}
+
+		c.Instructions = append(c.Instructions, i)
+	}
+
+	return c
+}
+
+// Clone returns a copy of the circuit.
+func (c *Circuit) Clone() *Circuit {
+	clone := &Circuit{
+		Init:      append([][]complex128{}, c.Init...),
+		Clbits:    c.Clbits,
+		Registers: append([]Register{}, c.Registers...),
+	}
+
+	clone.Instructions = append([]Instruction{}, c.Instructions...)
+	return clone
+}
+
+// Inverse returns the circuit that undoes the circuit.
+// Circuits with measurements, resets or channels are not invertible.
+func (c *Circuit) Inverse() (*Circuit, error) {
+	inv := &Circuit{
+		Init:      append([][]complex128{}, c.Init...),
+		Clbits:    c.Clbits,
+		Registers: append([]Register{}, c.Registers...),
+	}
+
+	for i := len(c.Instructions) - 1; i > -1; i-- {
+		in, err := c.Instructions[i].Inverse()
+		if err != nil {
+			return nil, err
+		}
+
+		inv.Instructions = append(inv.Instructions, in)
+	}
+
+	return inv, nil
+}
+
+// String returns the instructions one per line.
+func (c *Circuit) String() string {
+	var b strings.Builder
+	for _, in := range c.Instructions {
+		b.WriteString(in.String())
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,440 @@
+package density
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/qubit"
+)
+
+// Matrix is the density matrix of a mixed state.
+type Matrix struct {
+	m matrix.Matrix
+
+	// rnd is the source of the measurements, nil for the global one.
+	rnd *rand.Rand
+
+	// workers is the number of goroutines of the matrix products,
+	// 0 for one per CPU.
+	workers int
+}
+
+// New returns the density matrix of the pure state made of complex inputs.
+func New(z ...complex128) *Matrix {
+	return Pure(qubit.New(z...))
+}
+
+// Pure returns the density matrix |q><q| of the qubit.
+func Pure(q *qubit.Qubit) *Matrix {
+	amp := q.Amplitude()
+
+	m := make(matrix.Matrix, len(amp))
+	for i := range amp {
+		m[i] = make([]complex128, len(amp))
+		for j := range amp {
+			m[i][j] = amp[i] * cmplx.Conj(amp[j])
+		}
+	}
+
+	return &Matrix{m: m}
+}
+
+// Mixed returns the density matrix sum p_i|q_i><q_i|.
+func Mixed(p []float64, q []*qubit.Qubit) *Matrix {
+	d := Pure(q[0]).Mul(p[0])
+	for i := 1; i < len(q); i++ {
+		d = d.Add(Pure(q[i]).Mul(p[i]))
+	}
+
+	return d
+}
+
+func Zero(bit ...int) *Matrix {
+	return Pure(qubit.Zero(bit...))
+}
+
+func One(bit ...int) *Matrix {
+	return Pure(qubit.One(bit...))
+}
+
+func (d *Matrix) NumberOfBit() int {
+	dim := float64(len(d.m))
+	log := math.Log2(dim)
+	return int(log)
+}
+
+// Matrix returns a clone of the underlying matrix.
+func (d *Matrix) Matrix() matrix.Matrix {
+	return d.m.Clone()
+}
+
+// Clone returns a copy of the density matrix that shares its source of randomness.
+func (d *Matrix) Clone() *Matrix {
+	return &Matrix{m: d.m.Clone(), rnd: d.rnd, workers: d.workers}
+}
+
+// Rand makes the measurements draw from the source, so that a seeded
+// source gives the same results in every run. A nil source is the global one.
+func (d *Matrix) Rand(src rand.Source) *Matrix {
+	d.rnd = nil
+	if src != nil {
+		d.rnd = rand.New(src)
+	}
+
+	return d
+}
+
+// Workers sets the number of goroutines that multiply the matrix by the
+// unitaries of Apply when it has at least 2^14 elements. 0 is one per CPU,
+// the default, and 1 runs the products on the calling goroutine.
+func (d *Matrix) Workers(n int) *Matrix {
+	d.workers = n
+	return d
+}
+
+// float64 returns a random number in [0.0,1.0) from the source of the matrix.
+func (d *Matrix) float64() float64 {
+	if d.rnd == nil {
+		return rand.Float64()
+	}
+
+	return d.rnd.Float64()
+}
+
+func (d *Matrix) Equals(d0 *Matrix, eps ...float64) bool {
+	return d.m.Equals(d0.m, eps...)
+}
+
+// Mul returns the density matrix multiplied by the weight p.
+func (d *Matrix) Mul(p float64) *Matrix {
+	return &Matrix{m: d.m.Mul(complex(p, 0))}
+}
+
+// Add returns the sum of the two density matrices.
+func (d *Matrix) Add(d0 *Matrix) *Matrix {
+	return &Matrix{m: d.m.Add(d0.m)}
+}
+
+func (d *Matrix) Trace() float64 {
+	return real(d.m.Trace())
+}
+
+// Purity returns Tr(rho^2) which is 1 for pure states only.
+func (d *Matrix) Purity() float64 {
+	var sum float64
+	for i := range d.m {
+		for j := range d.m[i] {
+			sum = sum + math.Pow(cmplx.Abs(d.m[i][j]), 2)
+		}
+	}
+
+	return sum
+}
+
+func (d *Matrix) TensorProduct(d0 *Matrix) *Matrix {
+	d.m = d.m.TensorProduct(d0.m)
+	return d
+}
+
+// Apply evolves the density matrix with the unitary of the whole register.
+func (d *Matrix) Apply(u matrix.Matrix) *Matrix {
+	d.m = u.Dagger().Apply(d.m.Apply(u, d.workers), d.workers)
+	return d
+}
+
+// ApplyAt applies the 2x2 matrix u to the target bit in place,
+// only where every control bit is |1>. rho becomes U rho U^dagger.
+func (d *Matrix) ApplyAt(u matrix.Matrix, target int, control ...int) *Matrix {
+	t := d.mask(target)
+
+	c := 0
+	for _, ci := range control {
+		c = c | d.mask(ci)
+	}
+
+	dim := len(d.m)
+	for i := 0; i < dim; i = i + 2*t {
+		for j := i; j < i+t; j++ {
+			if j&c != c {
+				continue
+			}
+
+			// U rho
+			r0, r1 := d.m[j], d.m[j+t]
+			for k := 0; k < dim; k++ {
+				a0, a1 := r0[k], r1[k]
+				r0[k] = u[0][0]*a0 + u[0][1]*a1
+				r1[k] = u[1][0]*a0 + u[1][1]*a1
+			}
+		}
+	}
+
+	u00, u01 := cmplx.Conj(u[0][0]), cmplx.Conj(u[0][1])
+	u10, u11 := cmplx.Conj(u[1][0]), cmplx.Conj(u[1][1])
+	for _, r := range d.m {
+		for i := 0; i < dim; i = i + 2*t {
+			for j := i; j < i+t; j++ {
+				if j&c != c {
+					continue
+				}
+
+				// rho U^dagger
+				a0, a1 := r[j], r[j+t]
+				r[j] = a0*u00 + a1*u01
+				r[j+t] = a0*u10 + a1*u11
+			}
+		}
+	}
+
+	return d
+}
+
+// ApplyControlled applies the 2^k x 2^k matrix u to the k target bits
+// in place, target[0] being the most significant bit of u, only where
+// every control bit is |1> and every open control bit is |0>.
+// rho becomes U rho U^dagger.
+func (d *Matrix) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) *Matrix {
+	off := d.offsets(target)
+	t := off[len(off)-1]
+
+	c, o := 0, 0
+	for _, ci := range control {
+		c = c | d.mask(ci)
+	}
+	for _, oi := range open {
+		o = o | d.mask(oi)
+	}
+
+	base := []int{}
+	for i := range d.m {
+		if i&t == 0 && i&c == c && i&o == 0 {
+			base = append(base, i)
+		}
+	}
+
+	// U rho
+	a := make([]complex128, len(off))
+	for _, i := range base {
+		for k := range d.m {
+			for y := range off {
+				a[y] = d.m[i|off[y]][k]
+			}
+
+			for x := range off {
+				sum := complex(0, 0)
+				for y := range off {
+					sum = sum + u[x][y]*a[y]
+				}
+				d.m[i|off[x]][k] = sum
+			}
+		}
+	}
+
+	// rho U^dagger
+	for _, r := range d.m {
+		for _, i := range base {
+			for y := range off {
+				a[y] = r[i|off[y]]
+			}
+
+			for x := range off {
+				sum := complex(0, 0)
+				for y := range off {
+					sum = sum + a[y]*cmplx.Conj(u[x][y])
+				}
+				r[i|off[x]] = sum
+			}
+		}
+	}
+
+	return d
+}
+
+// Expectation returns Tr(rho U) of the 2^k x 2^k matrix u on the k target bits,
+// target[0] being the most significant bit of u.
+func (d *Matrix) Expectation(u matrix.Matrix, target ...int) complex128 {
+	off := d.offsets(target)
+	t := off[len(off)-1]
+
+	sum := complex(0, 0)
+	for i := range d.m {
+		if i&t != 0 {
+			continue
+		}
+
+		for x := range off {
+			for y := range off {
+				sum = sum + u[x][y]*d.m[i|off[y]][i|off[x]]
+			}
+		}
+	}
+
+	return sum
+}
+
+// ApplyKraus applies the channel given by the 2x2 Kraus operators
+// to the target bit. rho becomes sum K rho K^dagger.
+func (d *Matrix) ApplyKraus(k []matrix.Matrix, target int) *Matrix {
+	sum := d.Clone().ApplyAt(k[0], target)
+	for i := 1; i < len(k); i++ {
+		sum = sum.Add(d.Clone().ApplyAt(k[i], target))
+	}
+
+	d.m = sum.m
+	return d
+}
+
+// Swap exchanges the two bits in place.
+func (d *Matrix) Swap(b0, b1 int) *Matrix {
+	m0, m1 := d.mask(b0), d.mask(b1)
+	if m0 == m1 {
+		return d
+	}
+
+	for i := range d.m {
+		if i&m0 != 0 && i&m1 == 0 {
+			j := i ^ m0 ^ m1
+			d.m[i], d.m[j] = d.m[j], d.m[i]
+		}
+	}
+
+	for _, r := range d.m {
+		for i := range r {
+			if i&m0 != 0 && i&m1 == 0 {
+				j := i ^ m0 ^ m1
+				r[i], r[j] = r[j], r[i]
+			}
+		}
+	}
+
+	return d
+}
+
+// Probability returns the diagonal elements of the density matrix.
+func (d *Matrix) Probability() []float64 {
+	list := []float64{}
+	for i := range d.m {
+		list = append(list, real(d.m[i][i]))
+	}
+	return list
+}
+
+// Measure measures the bit and returns the result as |0> or |1>.
+// Without the bit every bit is measured and the result is the basis state.
+func (d *Matrix) Measure(bit ...int) *qubit.Qubit {
+	if len(bit) > 0 {
+		return d.MeasureAt(bit[0])
+	}
+
+	m := []*qubit.Qubit{}
+	for i := 0; i < d.NumberOfBit(); i++ {
+		m = append(m, d.MeasureAt(i))
+	}
+
+	return qubit.TensorProduct(m...)
+}
+
+func (d *Matrix) MeasureAt(bit int) *qubit.Qubit {
+	mask := d.mask(bit)
+
+	var sum float64
+	for i := range d.m {
+		if i&mask == 0 {
+			sum = sum + real(d.m[i][i])
+		}
+	}
+
+	if d.float64() > sum {
+		d.project(mask, mask, 1-sum)
+		return qubit.One()
+	}
+
+	d.project(mask, 0, sum)
+	return qubit.Zero()
+}
+
+// project keeps the elements whose row and column have the masked bit
+// equal to value and renormalizes them by the probability p.
+func (d *Matrix) project(mask, value int, p float64) {
+	z := complex(1/p, 0)
+	for i := range d.m {
+		for j := range d.m[i] {
+			if i&mask != value || j&mask != value {
+				d.m[i][j] = complex(0, 0)
+				continue
+			}
+			d.m[i][j] = z * d.m[i][j]
+		}
+	}
+}
+
+// PartialTrace returns the reduced density matrix traced over the bits.
+func (d *Matrix) PartialTrace(bit ...int) *Matrix {
+	n := d.NumberOfBit()
+
+	traced := 0
+	for _, b := range bit {
+		traced = traced | d.mask(b)
+	}
+
+	keep := []int{}
+	for i := 0; i < n; i++ {
+		if traced&d.mask(i) == 0 {
+			keep = append(keep, d.mask(i))
+		}
+	}
+
+	// reduced index of the kept bits
+	reduce := func(i int) int {
+		r := 0
+		for _, k := range keep {
+			r = r << 1
+			if i&k != 0 {
+				r = r | 1
+			}
+		}
+		return r
+	}
+
+	dim := 1 << uint(len(keep))
+	m := make(matrix.Matrix, dim)
+	for i := range m {
+		m[i] = make([]complex128, dim)
+	}
+
+	for i := range d.m {
+		for j := range d.m[i] {
+			if i&traced != j&traced {
+				continue
+			}
+			m[reduce(i)][reduce(j)] = m[reduce(i)][reduce(j)] + d.m[i][j]
+		}
+	}
+
+	return &Matrix{m: m}
+}
+
+// mask returns the index bit of the elements that corresponds to the bit.
+// The bit 0 is the most significant one.
+func (d *Matrix) mask(bit int) int {
+	return 1 << uint(d.NumberOfBit()-1-bit)
+}
+
+// offsets returns the offsets from the index where the target bits are 0
+// of the indices where they take each value, target[0] being the most
+// significant bit. The last offset has all the target bits set.
+func (d *Matrix) offsets(target []int) []int {
+	k := uint(len(target))
+	off := make([]int, 1<<k)
+	for a := range off {
+		for j, t := range target {
+			if a&(1<<(k-1-uint(j))) != 0 {
+				off[a] = off[a] | d.mask(t)
+			}
+		}
+	}
+
+	return off
+}
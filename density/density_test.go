@@ -0,0 +1,154 @@
+package density
+
+import (
+	"math"
+	"testing"
+
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/qubit"
+)
+
+func TestPure(t *testing.T) {
+	d := New(1, 2)
+
+	if math.Abs(d.Trace()-1) > 1e-13 {
+		t.Error(d.Trace())
+	}
+
+	if math.Abs(d.Purity()-1) > 1e-13 {
+		t.Error(d.Purity())
+	}
+
+	p := d.Probability()
+	if math.Abs(p[0]-0.2) > 1e-13 || math.Abs(p[1]-0.8) > 1e-13 {
+		t.Error(p)
+	}
+}
+
+func TestMixed(t *testing.T) {
+	d := Mixed([]float64{0.5, 0.5}, []*qubit.Qubit{qubit.Zero(), qubit.One()})
+
+	if !d.Matrix().Equals(gate.I().Mul(0.5)) {
+		t.Error(d.Matrix())
+	}
+
+	if math.Abs(d.Purity()-0.5) > 1e-13 {
+		t.Error(d.Purity())
+	}
+}
+
+func TestApplyAt(t *testing.T) {
+	var test = []struct {
+		u       matrix.Matrix
+		target  int
+		control []int
+		dense   matrix.Matrix
+	}{
+		{gate.H(), 0, []int{}, matrix.TensorProduct(gate.H(), gate.I(2))},
+		{gate.S(), 2, []int{}, matrix.TensorProduct(gate.I(2), gate.S())},
+		{gate.X(), 2, []int{0}, gate.CNOT(3, 0, 2)},
+		{gate.X(), 1, []int{0, 2}, gate.ControlledNot(3, []int{0, 2}, 1)},
+		{gate.R(3), 1, []int{2}, gate.CR(3, 2, 1, 3)},
+	}
+
+	for _, tt := range test {
+		expected := New(1, 2, 3, 4, 5, 6, 7, 8).Apply(tt.dense)
+		actual := New(1, 2, 3, 4, 5, 6, 7, 8).ApplyAt(tt.u, tt.target, tt.control...)
+
+		if !actual.Equals(expected, 1e-13) {
+			t.Errorf("%v: %v\n", actual, expected)
+		}
+	}
+}
+
+func TestApplyControlled(t *testing.T) {
+	// open controls are controls between two X
+	x0 := matrix.TensorProduct(gate.X(), gate.I(2))
+
+	var test = []struct {
+		u       matrix.Matrix
+		control []int
+		open    []int
+		target  []int
+		dense   matrix.Matrix
+	}{
+		{gate.X(), []int{0, 1}, []int{}, []int{2}, gate.Toffoli()},
+		{gate.Swap(2, 0, 1), []int{0}, []int{}, []int{1, 2}, gate.Fredkin()},
+		{gate.Swap(2, 0, 1), []int{}, []int{0}, []int{1, 2}, x0.Apply(gate.Fredkin()).Apply(x0)},
+		{gate.CNOT(2, 0, 1), []int{}, []int{}, []int{2, 0}, gate.CNOT(3, 2, 0)},
+		{gate.H(), []int{2}, []int{0}, []int{1}, x0.Apply(gate.Controlled(gate.H(), 3, []int{0, 2}, 1)).Apply(x0)},
+	}
+
+	for _, tt := range test {
+		expected := New(1, 2, 3, 4, 5, 6, 7, 8).Apply(tt.dense)
+		actual := New(1, 2, 3, 4, 5, 6, 7, 8).ApplyControlled(tt.u, tt.control, tt.open, tt.target...)
+
+		if !actual.Equals(expected, 1e-13) {
+			t.Errorf("%v: %v\n", actual, expected)
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	// 7 qbits are 2^14 elements, the smallest matrix split across goroutines
+	z := make([]complex128, 1<<7)
+	for i := range z {
+		z[i] = complex(float64(i), 1)
+	}
+	u := matrix.TensorProduct(gate.H(), gate.I(6))
+
+	expected := New(z...).Workers(1).Apply(u)
+	for _, w := range []int{0, 2, 3} {
+		actual := New(z...).Workers(w).Apply(u)
+		if !actual.Equals(expected, 1e-13) {
+			t.Errorf("workers=%d", w)
+		}
+
+		if !actual.Clone().Apply(u).Equals(New(z...), 1e-13) {
+			t.Errorf("workers=%d: clone", w)
+		}
+	}
+}
+
+func TestSwap(t *testing.T) {
+	expected := New(1, 2, 3, 4, 5, 6, 7, 8).Apply(gate.Swap(3, 0, 2))
+	actual := New(1, 2, 3, 4, 5, 6, 7, 8).Swap(0, 2)
+
+	if !actual.Equals(expected, 1e-13) {
+		t.Errorf("%v: %v\n", actual, expected)
+	}
+}
+
+func TestPartialTrace(t *testing.T) {
+	bell := Zero(2).ApplyAt(gate.H(), 0).ApplyAt(gate.X(), 1, 0)
+
+	r0 := bell.PartialTrace(1)
+	if !r0.Matrix().Equals(gate.I().Mul(0.5), 1e-13) {
+		t.Error(r0.Matrix())
+	}
+
+	d := Zero().TensorProduct(New(1, 2)).TensorProduct(One())
+	r1 := d.PartialTrace(0, 2)
+	if !r1.Equals(New(1, 2), 1e-13) {
+		t.Error(r1.Matrix())
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	bell := Zero(2).ApplyAt(gate.H(), 0).ApplyAt(gate.X(), 1, 0)
+
+	m0 := bell.Measure(0)
+	m1 := bell.Measure(1)
+	if !m0.Equals(m1) {
+		t.Errorf("%v: %v\n", m0, m1)
+	}
+
+	if math.Abs(bell.Trace()-1) > 1e-13 {
+		t.Error(bell.Trace())
+	}
+
+	if math.Abs(bell.Purity()-1) > 1e-13 {
+		t.Error(bell.Purity())
+	}
+}
@@ -0,0 +1,239 @@
+// Package draw renders circuits as diagrams.
+package draw
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/axamon/q"
+)
+
+// kind is the kind of the symbol of an instruction on a wire.
+type kind int
+
+const (
+	box     kind = iota // gate with a label
+	control             // control dot
+	open                // control on |0>
+	not                 // target of a controlled X
+	cross               // end of a swap
+	meter               // measurement
+	write               // classical bit written by a measurement
+	cond                // classical bit of a condition, labeled with its value
+	barrier
+)
+
+// element is the symbol of an instruction on a wire.
+// The wires of the qbits come first, then the wires of the classical bits.
+type element struct {
+	wire  int
+	kind  kind
+	label string
+}
+
+// diagram is a circuit laid out in moments.
+type diagram struct {
+	qbits  int
+	clbits int
+
+	// moments are the elements of the instructions in each column.
+	moments [][][]element
+}
+
+// layout places each instruction in the first column after the columns of
+// the instructions before it on the wires it spans, so that parallel gates
+// share a column.
+func layout(c *q.Circuit) *diagram {
+	d := &diagram{qbits: c.NumberOfBit(), clbits: c.Clbits}
+
+	last := make([]int, d.qbits+d.clbits)
+	for _, in := range c.Instructions {
+		e := elements(in, d.qbits)
+		if len(e) == 0 {
+			continue
+		}
+
+		lo, hi := span(e)
+		col := 0
+		for w := lo; w <= hi; w++ {
+			if last[w] > col {
+				col = last[w]
+			}
+		}
+
+		for w := lo; w <= hi; w++ {
+			last[w] = col + 1
+		}
+
+		if col == len(d.moments) {
+			d.moments = append(d.moments, nil)
+		}
+		d.moments[col] = append(d.moments[col], e)
+	}
+
+	return d
+}
+
+// span returns the first and the last wire of the elements.
+func span(e []element) (int, int) {
+	lo, hi := e[0].wire, e[0].wire
+	for _, x := range e {
+		if x.wire < lo {
+			lo = x.wire
+		}
+		if x.wire > hi {
+			hi = x.wire
+		}
+	}
+
+	return lo, hi
+}
+
+// elements returns the symbols of the instruction on the wires.
+func elements(in q.Instruction, qbits int) []element {
+	e := []element{}
+	for _, c := range in.Control {
+		e = append(e, element{c, control, ""})
+	}
+	for _, c := range in.Open {
+		e = append(e, element{c, open, ""})
+	}
+
+	switch {
+	case in.Name == "measure":
+		for i, t := range in.Target {
+			e = append(e, element{t, meter, "M"})
+			if i < len(in.Clbit) {
+				e = append(e, element{qbits + in.Clbit[i], write, ""})
+			}
+		}
+	case in.Name == "barrier":
+		for _, t := range in.Target {
+			e = append(e, element{t, barrier, ""})
+		}
+	case in.Name == "swap":
+		for _, t := range in.Target {
+			e = append(e, element{t, cross, ""})
+		}
+	case in.Name == "x" && len(in.Control)+len(in.Open) > 0:
+		e = append(e, element{in.Target[0], not, ""})
+	default:
+		for _, t := range in.Target {
+			e = append(e, element{t, box, label(in)})
+		}
+	}
+
+	if in.Condition != nil {
+		for i, c := range in.Condition.Clbit {
+			e = append(e, element{qbits + c, cond, strconv.Itoa(in.Condition.Value >> uint(i) & 1)})
+		}
+	}
+
+	return e
+}
+
+// label returns the label of the gate such as H, R2, QFT or RX(0.5).
+func label(in q.Instruction) string {
+	switch in.Name {
+	case "sdg":
+		return "S+"
+	case "tdg":
+		return "T+"
+	case "r":
+		return "R" + strconv.Itoa(int(in.Params[0]))
+	case "iqft":
+		return "QFT+"
+	case "unitary":
+		return "U"
+	case "kraus":
+		return "K"
+	case "reset":
+		return "|0>"
+	}
+
+	l := strings.ToUpper(in.Name)
+	if len(in.Params) > 0 || len(in.Symbols) > 0 {
+		p := []string{}
+		for i := 0; i < len(in.Params) || i < len(in.Symbols); i++ {
+			switch {
+			case i < len(in.Symbols) && in.Symbols[i].Name != "":
+				p = append(p, in.Symbols[i].String())
+			case i < len(in.Params):
+				p = append(p, strconv.FormatFloat(in.Params[i], 'g', 3, 64))
+			default:
+				p = append(p, "0")
+			}
+		}
+		l = l + "(" + strings.Join(p, ",") + ")"
+	}
+
+	return l
+}
+
+// block returns the first and the last wire of the boxes of the instruction
+// if there are more than one on adjacent wires with nothing else in between,
+// as the QFT of consecutive qbits, so they can be drawn as one box.
+func block(e []element) (int, int, bool) {
+	wire := map[int]bool{}
+	for _, x := range e {
+		if x.kind == box {
+			wire[x.wire] = true
+		}
+	}
+
+	if len(wire) < 2 {
+		return 0, 0, false
+	}
+
+	lo, hi := -1, -1
+	for w := range wire {
+		if lo < 0 || w < lo {
+			lo = w
+		}
+		if w > hi {
+			hi = w
+		}
+	}
+
+	for w := lo; w <= hi; w++ {
+		if !wire[w] {
+			return 0, 0, false
+		}
+	}
+
+	for _, x := range e {
+		if x.kind != box && x.wire >= lo && x.wire <= hi {
+			return 0, 0, false
+		}
+	}
+
+	return lo, hi, true
+}
+
+// links returns the wires the vertical quantum and classical lines
+// of the instruction join. A line is empty if lo equals hi.
+// The classical line runs from the last qbit to the last classical bit.
+func links(e []element, qbits int) (qlo, qhi, chi int) {
+	qlo, qhi, chi = -1, -1, -1
+	for _, x := range e {
+		if x.wire >= qbits {
+			if x.wire > chi {
+				chi = x.wire
+			}
+			continue
+		}
+
+		if qlo < 0 || x.wire < qlo {
+			qlo = x.wire
+		}
+		if x.wire > qhi {
+			qhi = x.wire
+		}
+	}
+
+	if chi < 0 {
+		chi = qhi
+	}
+
+	return qlo, qhi, chi
+}
@@ -0,0 +1,70 @@
+package draw_test
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/axamon/q"
+	"github.com/axamon/q/draw"
+)
+
+func TestSVG(t *testing.T) {
+	c := q.NewCircuit(3).Append(
+		q.Instruction{Name: "qft", Target: []int{0, 1, 2}},
+		q.Instruction{Name: "x", Target: []int{2}, Control: []int{0, 1}},
+		q.Instruction{Name: "measure", Target: []int{0}, Clbit: []int{0}},
+		q.Instruction{Name: "reset", Target: []int{0}},
+		q.Instruction{Name: "z", Target: []int{1}, Condition: &q.Condition{Clbit: []int{0}, Value: 1}},
+	)
+
+	src := draw.SVG(c)
+
+	elements := map[string]int{}
+	text := []string{}
+	d := xml.NewDecoder(strings.NewReader(src))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", err, src)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			elements[tok.Name.Local]++
+		case xml.CharData:
+			if s := strings.TrimSpace(string(tok)); s != "" {
+				text = append(text, s)
+			}
+		}
+	}
+
+	if strings.Join(text, " ") != "q0 q1 q2 c0 QFT |0> Z" {
+		t.Error(text)
+	}
+
+	// 2 controls, the target of X and the condition
+	if elements["circle"] != 4 {
+		t.Error(elements)
+	}
+}
+
+func TestLaTeXApart(t *testing.T) {
+	c := q.NewCircuit(3).Append(
+		q.Instruction{Name: "qft", Target: []int{2, 0}, Control: []int{1}},
+	)
+
+	want := `\begin{quantikz}
+\lstick{$q_{0}$} & \gate{\mathrm{QFT}} \vqw{2} & \qw \\
+\lstick{$q_{1}$} & \ctrl{1} & \qw \\
+\lstick{$q_{2}$} & \gate{\mathrm{QFT}} & \qw
+\end{quantikz}
+`
+	if got := draw.LaTeX(c); got != want {
+		t.Error(got)
+	}
+}
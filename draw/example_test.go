@@ -0,0 +1,78 @@
+package draw_test
+
+import (
+	"fmt"
+
+	"github.com/axamon/q"
+	"github.com/axamon/q/draw"
+)
+
+func ExampleText() {
+	qsim := q.New()
+
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+
+	qsim.H(q0, q2)
+	qsim.CNOT(q0, q1)
+	qsim.CR(q2, q0, 2)
+	qsim.Swap(q1, q2)
+	qsim.QFT()
+	qsim.Measure(q0)
+
+	fmt.Print(draw.Text(qsim.Circuit()))
+
+	// Output:
+	// q0: -[H]--*--[R2]---[QFT]-[M]-
+	//           |   |     |   |  |
+	// q1: -----(+)--+---x-[   ]--+--
+	//               |   | |   |  |
+	// q2: -[H]------*---x-[   ]--+--
+	//                            |
+	// c0: =======================v==
+}
+
+func ExampleText_condition() {
+	c := q.NewCircuit(2).Append(
+		q.Instruction{Name: "h", Target: []int{0}},
+		q.Instruction{Name: "measure", Target: []int{0}, Clbit: []int{0}},
+		q.Instruction{Name: "barrier", Target: []int{0, 1}},
+		q.Instruction{Name: "x", Target: []int{1}, Condition: &q.Condition{Clbit: []int{0, 1}, Value: 1}},
+	)
+
+	fmt.Print(draw.Text(c))
+
+	// Output:
+	// q0: -[H]-[M]-|-----
+	//           |  |
+	// q1: ------+--|-[X]-
+	//           |     |
+	// c0: ======v====(1)=
+	//                 |
+	// c1: ===========(0)=
+}
+
+func ExampleLaTeX() {
+	qsim := q.New()
+
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+
+	qsim.H(q0)
+	qsim.ControlledNot([]*q.Qubit{q0, q1}, q2)
+	qsim.Swap(q0, q1)
+	qsim.InverseQFT()
+	qsim.Measure(q1)
+
+	fmt.Print(draw.LaTeX(qsim.Circuit()))
+
+	// Output:
+	// \begin{quantikz}
+	// \lstick{$q_{0}$} & \gate{H} & \ctrl{2} & \swap{1} & \gate[3]{\mathrm{QFT}^\dagger} & \qw & \qw \\
+	// \lstick{$q_{1}$} & \qw & \ctrl{1} & \targX{} & \qw & \meter{} \vcw{2} & \qw \\
+	// \lstick{$q_{2}$} & \qw & \targ{} & \qw & \qw & \qw & \qw \\
+	// \lstick{$c_{0}$} & \cw & \cw & \cw & \cw & \cw & \cw
+	// \end{quantikz}
+}
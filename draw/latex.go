@@ -0,0 +1,172 @@
+package draw
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/axamon/q"
+)
+
+// LaTeX returns the quantikz environment of the circuit.
+// Measurements and classical conditions are joined to the classical
+// wires by \vcw, the bits of a condition are \control{} for 1
+// and \ocontrol{} for 0. The boxes of a gate on qbits that are not
+// adjacent are joined by \vqw.
+func LaTeX(c *q.Circuit) string {
+	d := layout(c)
+	wires := d.qbits + d.clbits
+
+	cells := make([][]string, wires)
+	for w := 0; w < wires; w++ {
+		if w < d.qbits {
+			cells[w] = append(cells[w], fmt.Sprintf("\\lstick{$q_{%d}$}", w))
+			continue
+		}
+		cells[w] = append(cells[w], fmt.Sprintf("\\lstick{$c_{%d}$}", w-d.qbits))
+	}
+
+	for _, m := range d.moments {
+		col := make([]string, wires)
+		for _, e := range m {
+			for _, s := range commands(e, d.qbits) {
+				col[s.wire] = s.label
+			}
+		}
+
+		for w := 0; w < wires; w++ {
+			cells[w] = append(cells[w], col[w])
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\\begin{quantikz}\n")
+	for w := 0; w < wires; w++ {
+		wire := "\\qw"
+		if w >= d.qbits {
+			wire = "\\cw"
+		}
+
+		for i := range cells[w] {
+			if cells[w][i] == "" {
+				cells[w][i] = wire
+			}
+		}
+
+		b.WriteString(strings.Join(append(cells[w], wire), " & "))
+		if w < wires-1 {
+			b.WriteString(" \\\\")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\\end{quantikz}\n")
+
+	return b.String()
+}
+
+// commands returns the quantikz commands of the elements of an instruction
+// as elements whose labels are the commands.
+func commands(e []element, qbits int) []element {
+	// the wire the controls and the first end of a swap point to
+	target := -1
+	for _, x := range e {
+		if x.kind != control && x.kind != open && x.wire < qbits {
+			target = x.wire
+			break
+		}
+	}
+
+	qlo, qhi, chi := links(e, qbits)
+	lo, hi, ok := block(e)
+
+	// the next box of the gate below each box
+	boxes := []int{}
+	for _, x := range e {
+		if x.kind == box {
+			boxes = append(boxes, x.wire)
+		}
+	}
+	sort.Ints(boxes)
+
+	next := map[int]int{}
+	for i := 1; i < len(boxes); i++ {
+		next[boxes[i-1]] = boxes[i]
+	}
+
+	out := []element{}
+	swapped := false
+	for _, x := range e {
+		var s string
+		switch x.kind {
+		case box:
+			switch {
+			case !ok:
+				s = fmt.Sprintf("\\gate{%s}", tex(x.label))
+				if n, below := next[x.wire]; below {
+					s = s + fmt.Sprintf(" \\vqw{%d}", n-x.wire)
+				}
+			case x.wire == lo:
+				s = fmt.Sprintf("\\gate[%d]{%s}", hi-lo+1, tex(x.label))
+			default:
+				s = "\\qw"
+			}
+		case control:
+			s = fmt.Sprintf("\\ctrl{%d}", target-x.wire)
+		case open:
+			s = fmt.Sprintf("\\octrl{%d}", target-x.wire)
+		case not:
+			s = "\\targ{}"
+		case cross:
+			s = "\\targX{}"
+			if !swapped {
+				for _, y := range e {
+					if y.kind == cross && y.wire != x.wire {
+						s = fmt.Sprintf("\\swap{%d}", y.wire-x.wire)
+					}
+				}
+				swapped = true
+			}
+		case meter:
+			s = "\\meter{}"
+		case write:
+			s = "\\cw"
+		case cond:
+			s = "\\ocontrol{}"
+			if x.label == "1" {
+				s = "\\control{}"
+			}
+		case barrier:
+			// one slice crosses all the wires
+			s = "\\qw"
+			if x.wire == qlo {
+				s = "\\qw \\slice{}"
+			}
+		}
+
+		if x.wire == qhi && chi > qhi {
+			s = s + fmt.Sprintf(" \\vcw{%d}", chi-qhi)
+		}
+
+		out = append(out, element{x.wire, x.kind, s})
+	}
+
+	return out
+}
+
+// tex returns the label in math mode, e.g. R_{2} for R2 and S^\dagger for S+.
+func tex(label string) string {
+	if strings.HasSuffix(label, "+") {
+		return tex(strings.TrimSuffix(label, "+")) + "^\\dagger"
+	}
+
+	switch {
+	case label == "|0>":
+		return "\\ket{0}"
+	case len(label) > 1 && label[0] == 'R' && label[1] >= '0' && label[1] <= '9':
+		return "R_{" + label[1:] + "}"
+	case len(label) > 1 && !strings.Contains(label, "("):
+		return "\\mathrm{" + label + "}"
+	}
+
+	return label
+}
@@ -0,0 +1,141 @@
+package draw
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/axamon/q"
+)
+
+const (
+	row    = 50 // distance between wires
+	margin = 50 // width of the names of the wires
+	gap    = 10 // distance between moments
+)
+
+// SVG returns the circuit drawn as a standalone SVG image
+// with the symbols of Text.
+func SVG(c *q.Circuit) string {
+	d := layout(c)
+	wires := d.qbits + d.clbits
+
+	y := func(w int) float64 {
+		return float64(row/2 + row*w)
+	}
+
+	// the width of each moment fits its longest label
+	x, width := []float64{}, []float64{}
+	left := float64(margin + gap)
+	for _, m := range d.moments {
+		w := 40.0
+		for _, e := range m {
+			for _, el := range e {
+				if l := float64(8*len(el.label) + 20); el.kind == box && l > w {
+					w = l
+				}
+			}
+		}
+
+		x = append(x, left+w/2)
+		width = append(width, w)
+		left = left + w + gap
+	}
+	right := left + gap
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%g\" height=\"%d\" viewBox=\"0 0 %g %d\">\n", right, row*wires, right, row*wires)
+	b.WriteString("<rect width=\"100%\" height=\"100%\" fill=\"white\"/>\n")
+	b.WriteString("<g stroke=\"black\" stroke-width=\"1.5\" font-family=\"serif\" font-size=\"16\">\n")
+
+	for w := 0; w < wires; w++ {
+		n := fmt.Sprintf("q%d", w)
+		if w >= d.qbits {
+			n = fmt.Sprintf("c%d", w-d.qbits)
+			double(&b, margin, y(w), right, y(w))
+		} else {
+			line(&b, margin, y(w), right, y(w))
+		}
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%g\" stroke=\"none\" text-anchor=\"end\" dominant-baseline=\"central\">%s</text>\n", margin-gap, y(w), n)
+	}
+
+	for i, m := range d.moments {
+		cx := x[i]
+		for _, e := range m {
+			qlo, qhi, chi := links(e, d.qbits)
+			if qhi > qlo {
+				line(&b, cx, y(qlo), cx, y(qhi))
+			}
+			if chi > qhi {
+				double(&b, cx, y(qhi), cx, y(chi))
+			}
+
+			lo, hi, ok := block(e)
+			for _, el := range e {
+				if ok && el.kind == box {
+					if el.wire == lo {
+						rect(&b, cx, (y(lo)+y(hi))/2, width[i], y(hi)-y(lo)+30, el.label)
+					}
+					continue
+				}
+				shape(&b, el, cx, y(el.wire), width[i])
+			}
+		}
+	}
+
+	b.WriteString("</g>\n</svg>\n")
+	return b.String()
+}
+
+// shape draws the symbol of the element centered on (x, y).
+func shape(b *strings.Builder, e element, x, y, width float64) {
+	switch e.kind {
+	case box:
+		rect(b, x, y, width, 30, e.label)
+	case control:
+		fmt.Fprintf(b, "<circle cx=\"%g\" cy=\"%g\" r=\"5\" fill=\"black\"/>\n", x, y)
+	case open:
+		fmt.Fprintf(b, "<circle cx=\"%g\" cy=\"%g\" r=\"5\" fill=\"white\"/>\n", x, y)
+	case not:
+		fmt.Fprintf(b, "<circle cx=\"%g\" cy=\"%g\" r=\"10\" fill=\"white\"/>\n", x, y)
+		line(b, x-10, y, x+10, y)
+		line(b, x, y-10, x, y+10)
+	case cross:
+		line(b, x-7, y-7, x+7, y+7)
+		line(b, x-7, y+7, x+7, y-7)
+	case meter:
+		fmt.Fprintf(b, "<rect x=\"%g\" y=\"%g\" width=\"30\" height=\"30\" fill=\"white\"/>\n", x-15, y-15)
+		fmt.Fprintf(b, "<path d=\"M %g %g A 10 10 0 0 1 %g %g\" fill=\"none\"/>\n", x-10, y+6, x+10, y+6)
+		line(b, x, y+6, x+8, y-8)
+	case write:
+		fmt.Fprintf(b, "<polygon points=\"%g,%g %g,%g %g,%g\" fill=\"black\"/>\n", x-5, y-8, x+5, y-8, x, y)
+	case cond:
+		fill := "white"
+		if e.label == "1" {
+			fill = "black"
+		}
+		fmt.Fprintf(b, "<circle cx=\"%g\" cy=\"%g\" r=\"5\" fill=\"%s\"/>\n", x, y, fill)
+	case barrier:
+		fmt.Fprintf(b, "<line x1=\"%g\" y1=\"%g\" x2=\"%g\" y2=\"%g\" stroke-dasharray=\"4\"/>\n", x, y-row/2, x, y+row/2)
+	}
+}
+
+func rect(b *strings.Builder, x, y, w, h float64, label string) {
+	fmt.Fprintf(b, "<rect x=\"%g\" y=\"%g\" width=\"%g\" height=\"%g\" fill=\"white\"/>\n", x-w/2, y-h/2, w, h)
+	fmt.Fprintf(b, "<text x=\"%g\" y=\"%g\" stroke=\"none\" text-anchor=\"middle\" dominant-baseline=\"central\">%s</text>\n", x, y, html.EscapeString(label))
+}
+
+func line(b *strings.Builder, x1, y1, x2, y2 float64) {
+	fmt.Fprintf(b, "<line x1=\"%g\" y1=\"%g\" x2=\"%g\" y2=\"%g\"/>\n", x1, y1, x2, y2)
+}
+
+// double draws the double line of a classical wire.
+func double(b *strings.Builder, x1, y1, x2, y2 float64) {
+	dx, dy := 0.0, 1.5
+	if x1 == x2 {
+		dx, dy = 1.5, 0
+	}
+
+	fmt.Fprintf(b, "<line x1=\"%g\" y1=\"%g\" x2=\"%g\" y2=\"%g\" stroke-width=\"1\"/>\n", x1-dx, y1-dy, x2-dx, y2-dy)
+	fmt.Fprintf(b, "<line x1=\"%g\" y1=\"%g\" x2=\"%g\" y2=\"%g\" stroke-width=\"1\"/>\n", x1+dx, y1+dy, x2+dx, y2+dy)
+}
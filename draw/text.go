@@ -0,0 +1,142 @@
+package draw
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/axamon/q"
+)
+
+// Text returns the circuit drawn with ASCII characters. Qbits are wires
+// of -, classical bits are wires of =. Gates are boxes such as [H] or [R2],
+// * is a control, o a control on |0>, (+) the target of a controlled X,
+// x the ends of a swap, [M] a measurement writing the classical bit marked
+// with v and (0) or (1) the value of a classical bit conditioning a gate.
+// A gate on adjacent qbits, such as the QFT, is one box across their wires.
+//
+//	q0: -[H]--*--[M]-
+//	          |   |
+//	q1: -----(+)--+--
+//	              |
+//	c0: ==========v==
+func Text(c *q.Circuit) string {
+	d := layout(c)
+	wires := d.qbits + d.clbits
+
+	names := []string{}
+	width := 0
+	for w := 0; w < wires; w++ {
+		n := fmt.Sprintf("q%d: ", w)
+		if w >= d.qbits {
+			n = fmt.Sprintf("c%d: ", w-d.qbits)
+		}
+		if len(n) > width {
+			width = len(n)
+		}
+		names = append(names, n)
+	}
+
+	lines := make([]strings.Builder, 2*wires-1)
+	for w := 0; w < wires; w++ {
+		lines[2*w].WriteString(names[w] + strings.Repeat(" ", width-len(names[w])))
+		if w < wires-1 {
+			lines[2*w+1].WriteString(strings.Repeat(" ", width))
+		}
+	}
+
+	for _, m := range d.moments {
+		cells := make([]string, wires)
+		link := make([]string, wires)
+		size := 1
+
+		for _, e := range m {
+			lo, hi := span(e)
+			for w := lo; w <= hi; w++ {
+				cells[w] = "+"
+				if w < hi {
+					link[w] = "|"
+				}
+			}
+
+			for _, x := range e {
+				cells[x.wire] = symbol(x)
+			}
+
+			// the sides of the box of a block join its wires
+			if lo, hi, ok := block(e); ok {
+				inner := strings.Repeat(" ", len(cells[lo])-2)
+				for w := lo; w <= hi; w++ {
+					if w > lo {
+						cells[w] = "[" + inner + "]"
+					}
+					if w < hi {
+						link[w] = "|" + inner + "|"
+					}
+				}
+			}
+		}
+
+		for _, s := range cells {
+			if len(s) > size {
+				size = len(s)
+			}
+		}
+
+		for w := 0; w < wires; w++ {
+			fill := "-"
+			if w >= d.qbits {
+				fill = "="
+			}
+			lines[2*w].WriteString(fill + center(cells[w], size, fill))
+
+			if w < wires-1 {
+				lines[2*w+1].WriteString(" " + center(link[w], size, " "))
+			}
+		}
+	}
+
+	var b strings.Builder
+	for w := range lines {
+		fill := "-"
+		if w/2 >= d.qbits {
+			fill = "="
+		}
+		if w%2 == 1 {
+			fill = ""
+		}
+
+		b.WriteString(strings.TrimRight(lines[w].String()+fill, " "))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// symbol returns the ASCII symbol of the element.
+func symbol(e element) string {
+	switch e.kind {
+	case control:
+		return "*"
+	case open:
+		return "o"
+	case not:
+		return "(+)"
+	case cross:
+		return "x"
+	case write:
+		return "v"
+	case cond:
+		return "(" + e.label + ")"
+	case barrier:
+		return "|"
+	}
+
+	return "[" + e.label + "]"
+}
+
+// center returns s centered in size characters padded with fill.
+func center(s string, size int, fill string) string {
+	left := (size - len(s)) / 2
+	right := size - len(s) - left
+	return strings.Repeat(fill, left) + s + strings.Repeat(fill, right)
+}
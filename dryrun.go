@@ -0,0 +1,109 @@
+package q
+
+import (
+	"math/rand"
+
+	"github.com/axamon/q/density"
+	"github.com/axamon/q/matrix"
+)
+
+// Operation is an operation a DryRun received,
+// on the positions of the qbits.
+type Operation struct {
+	// Name is add, apply, kraus, swap, measure or release.
+	Name    string
+	Control []int
+	Open    []int
+	Target  []int
+}
+
+// DryRun is a Backend that records the operations instead of simulating
+// them, e.g. to count the gates of a circuit of too many qbits after the
+// noise model and the decomposition of QFT. Measurements read 0,
+// Probability and DensityMatrix are nil and expectation values are 0.
+type DryRun struct {
+	// Operations are the operations received in order.
+	Operations []Operation
+
+	bit int
+}
+
+// NewDryRun returns a DryRun with no qbits.
+func NewDryRun() *DryRun {
+	return &DryRun{}
+}
+
+func (d *DryRun) record(name string, control, open []int, target ...int) {
+	d.Operations = append(d.Operations, Operation{
+		Name:    name,
+		Control: append([]int{}, control...),
+		Open:    append([]int{}, open...),
+		Target:  append([]int{}, target...),
+	})
+}
+
+func (d *DryRun) Add(z ...complex128) error {
+	d.record("add", nil, nil, d.bit)
+	d.bit++
+	return nil
+}
+
+func (d *DryRun) NumberOfBit() int {
+	return d.bit
+}
+
+func (d *DryRun) ApplyAt(u matrix.Matrix, target int, control ...int) {
+	d.record("apply", control, nil, target)
+}
+
+func (d *DryRun) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) {
+	d.record("apply", control, open, target...)
+}
+
+func (d *DryRun) ApplyKraus(k []matrix.Matrix, target int) {
+	d.record("kraus", nil, nil, target)
+}
+
+func (d *DryRun) Swap(b0, b1 int) {
+	d.record("swap", nil, nil, b0, b1)
+}
+
+func (d *DryRun) Measure(bit int) bool {
+	d.record("measure", nil, nil, bit)
+	return false
+}
+
+func (d *DryRun) Probability() []float64 {
+	return nil
+}
+
+func (d *DryRun) DensityMatrix() *density.Matrix {
+	return nil
+}
+
+// Clone returns a DryRun of the same qbits with no operations.
+func (d *DryRun) Clone() Backend {
+	return &DryRun{bit: d.bit}
+}
+
+func (d *DryRun) Release(bit int) error {
+	d.record("release", nil, nil, bit)
+	d.bit--
+	return nil
+}
+
+func (d *DryRun) Expectation(u []matrix.Matrix, target [][]int) complex128 {
+	return 0
+}
+
+func (d *DryRun) Rand(src rand.Source) {}
+
+// sample returns shots of all zeros.
+func (d *DryRun) sample(shots int) [][]bool {
+	out := make([][]bool, 0, shots)
+	for i := 0; i < shots; i++ {
+		out = append(out, make([]bool, d.bit))
+	}
+
+	return out
+}
@@ -32,6 +32,9 @@ func main() {
 	qsim.ConditionX(m3.IsOne() && m4.IsOne(), q1)
 	qsim.ConditionX(m3.IsZero() && m4.IsOne(), q2)
 
+	// the measured ancilla qubits are no longer needed
+	qsim.Release(q3).Release(q4)
+
 	// estimate
 	qsim.Estimate(q0).Probability() // (0.2, 0.8)
 	qsim.Estimate(q1).Probability() // (0.2, 0.8)
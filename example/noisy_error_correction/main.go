@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/axamon/q"
+)
+
+func main() {
+
+	// Creates new simulation with the error budget of a device.
+	qsim := q.New(
+		q.WithDensityMatrix(),
+		q.WithNoise(&q.NoiseModel{
+			Gate:     map[string]float64{"x": 0.001, "cx": 0.01},
+			GateTime: map[string]float64{"x": 0.05, "cx": 0.3},
+			T1:       map[int]float64{0: 50, 1: 50, 2: 50, 3: 50, 4: 50},
+			T2:       map[int]float64{0: 70, 1: 70, 2: 70, 3: 70, 4: 70},
+			Readout:  map[int]q.Readout{3: {P01: 0.02, P10: 0.05}, 4: {P01: 0.02, P10: 0.05}},
+		}),
+	)
+
+	q0 := qsim.New(1, 2) // (0.2, 0.8)
+
+	// encoding
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+	qsim.CNOT(q0, q1).CNOT(q0, q2)
+
+	// error: first qubit is flipped
+	qsim.X(q0)
+
+	// add ancilla qubit
+	q3 := qsim.Zero()
+	q4 := qsim.Zero()
+
+	// error corretion
+	qsim.CNOT(q0, q3).CNOT(q1, q3)
+	qsim.CNOT(q1, q4).CNOT(q2, q4)
+
+	m3 := qsim.Measure(q3)
+	m4 := qsim.Measure(q4)
+
+	qsim.ConditionX(m3.IsOne() && m4.IsZero(), q0)
+	qsim.ConditionX(m3.IsOne() && m4.IsOne(), q1)
+	qsim.ConditionX(m3.IsZero() && m4.IsOne(), q2)
+
+	// q0 after the noisy correction
+	rho := qsim.DensityMatrix().PartialTrace(1, 2, 3, 4)
+	fmt.Println(rho.Probability()) // about (0.2, 0.8) unless the syndrome is misread
+}
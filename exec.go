@@ -0,0 +1,372 @@
+package q
+
+import (
+	"fmt"
+
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/noise"
+)
+
+// Circuit returns the circuit of the operations applied so far.
+func (q *Q) Circuit() *Circuit {
+	return q.circuit.Clone()
+}
+
+// Clbits returns the values of the classical bits written by the measurements.
+func (q *Q) Clbits() []int {
+	return append([]int{}, q.clbit...)
+}
+
+// Run executes the circuit. The register is extended with the qbits
+// of the circuit it does not have yet, initialized as in the circuit.
+// The classical bits of the circuit are the classical bits of the simulator.
+// It returns Err if a method failed before.
+func (q *Q) Run(c *Circuit) error {
+	if q.err != nil {
+		return q.err
+	}
+
+	for i := len(q.pos); i < c.NumberOfBit(); i++ {
+		if c.Init[i] == nil {
+			q.Zero()
+			continue
+		}
+		q.New(c.Init[i]...)
+	}
+
+	if q.err != nil {
+		return q.err
+	}
+
+	for _, r := range c.Registers {
+		if !q.circuit.register(r.Name) {
+			q.circuit.Registers = append(q.circuit.Registers, r)
+		}
+	}
+
+	for _, in := range c.Instructions {
+		if err := q.exec(in); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Exec executes the instructions on the register as Run does.
+func (q *Q) Exec(in ...Instruction) error {
+	if q.err != nil {
+		return q.err
+	}
+
+	for _, i := range in {
+		if err := q.exec(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exec applies the instruction to the register with the errors
+// of the noise model and records it in the circuit.
+// The symbolic parameters take the values bound to the simulator,
+// the circuit keeps them symbolic.
+func (q *Q) exec(in Instruction) error {
+	b, err := in.Bind(q.values)
+	if err != nil {
+		return err
+	}
+
+	if err := q.check(b); err != nil {
+		return err
+	}
+
+	if v, ok := q.state.(Validator); ok {
+		if err := v.Validate(q.local(b)); err != nil {
+			return err
+		}
+	}
+
+	if b.Condition == nil || q.holds(b.Condition) {
+		if err := q.execute(q.local(b)); err != nil {
+			return err
+		}
+	}
+
+	q.circuit.Append(in)
+	return nil
+}
+
+func (q *Q) execute(in Instruction) error {
+	switch in.Name {
+	case "measure":
+		for i, t := range in.Target {
+			one := q.state.Measure(t)
+			if q.misread(q.wire[t], one) {
+				one = !one
+			}
+
+			c := in.Clbit[i]
+			for len(q.clbit) <= c {
+				q.clbit = append(q.clbit, 0)
+			}
+
+			q.clbit[c] = 0
+			if one {
+				q.clbit[c] = 1
+			}
+		}
+	case "reset":
+		for _, t := range in.Target {
+			if q.state.Measure(t) {
+				q.state.ApplyAt(gate.X(), t)
+			}
+			q.applyNoise("reset", t)
+		}
+	case "kraus":
+		for _, t := range in.Target {
+			q.state.ApplyKraus(in.Kraus, t)
+		}
+	case "barrier":
+	case "swap":
+		if len(in.Control) > 0 || len(in.Open) > 0 {
+			a, b := in.Target[0], in.Target[1]
+			q.controlled("x", gate.X(), append(append([]int{}, in.Control...), b), in.Open, a)
+			q.controlled("x", gate.X(), append(append([]int{}, in.Control...), a), in.Open, b)
+			q.controlled("x", gate.X(), append(append([]int{}, in.Control...), b), in.Open, a)
+			break
+		}
+		q.swap(in.Target[0], in.Target[1])
+	case "qft":
+		q.qft(in.Target)
+	case "iqft":
+		q.iqft(in.Target)
+	default:
+		u := in.Unitary()
+		if u == nil {
+			return fmt.Errorf("%w: %v", ErrUnknownInstruction, in.Name)
+		}
+
+		// a 2x2 matrix is applied to each of the targets
+		if len(u) == 2 {
+			for _, t := range in.Target {
+				q.controlled(in.Name, u, in.Control, in.Open, t)
+			}
+			break
+		}
+
+		q.controlled(in.Name, u, in.Control, in.Open, in.Target...)
+	}
+
+	return nil
+}
+
+// check returns an error if the instruction cannot be applied to the register:
+// a qbit out of range, used twice, a gate without targets or a matrix
+// that is not unitary or does not match the number of targets.
+func (q *Q) check(in Instruction) error {
+	n := len(q.pos)
+	for _, list := range [][]int{in.Target, in.Control, in.Open} {
+		for _, b := range list {
+			if b < 0 || b >= n {
+				return fmt.Errorf("%w: %v: %d of %d qbits", ErrQubitOutOfRange, in.Name, b, n)
+			}
+			if q.pos[b] < 0 {
+				return fmt.Errorf("%w: %v: %d is released", ErrQubitOutOfRange, in.Name, b)
+			}
+		}
+	}
+
+	if n, ok := params[in.Name]; ok && len(in.Params) != n {
+		return fmt.Errorf("%w: %v: %d parameters of %d", ErrDimensionMismatch, in.Name, len(in.Params), n)
+	}
+
+	switch in.Name {
+	case "barrier":
+		return nil
+	case "measure":
+		if len(in.Clbit) < len(in.Target) {
+			return fmt.Errorf("%w: %v: %d classical bits for %d qbits", ErrDimensionMismatch, in.Name, len(in.Clbit), len(in.Target))
+		}
+		return nil
+	case "swap":
+		if len(in.Target) != 2 {
+			return fmt.Errorf("%w: %v: %d qbits", ErrDimensionMismatch, in.Name, len(in.Target))
+		}
+	case "kraus":
+		for _, k := range in.Kraus {
+			if len(k) != 2 || len(k[0]) != 2 || len(k[1]) != 2 {
+				return fmt.Errorf("%w: %v: operator of %d rows", ErrDimensionMismatch, in.Name, len(k))
+			}
+		}
+
+		if len(in.Kraus) == 0 || !noise.Channel(in.Kraus).IsComplete(noise.Eps) {
+			return fmt.Errorf("%w: %v", noise.ErrNotComplete, in.Name)
+		}
+	}
+
+	if len(in.Target) == 0 {
+		return fmt.Errorf("%w: %v", ErrNoQubit, in.Name)
+	}
+
+	// a 2x2 matrix is applied to each of the targets on its own
+	target := [][]int{in.Target}
+	u := in.Unitary()
+	if u != nil && len(u) == 2 {
+		target = [][]int{}
+		for _, t := range in.Target {
+			target = append(target, []int{t})
+		}
+	}
+
+	for _, t := range target {
+		if b, ok := repeated(t, in.Control, in.Open); ok {
+			return fmt.Errorf("%w: %v: %d", ErrDuplicateQubit, in.Name, b)
+		}
+	}
+
+	if in.Matrix == nil || u == nil {
+		return nil
+	}
+
+	if r, c := u.Dimension(); r != c || r != 2 && r != 1<<uint(len(in.Target)) {
+		return fmt.Errorf("%w: %v: matrix of dimension %dx%d on %d qbits", ErrDimensionMismatch, in.Name, r, c, len(in.Target))
+	}
+
+	for i, row := range u {
+		if len(row) != len(u) {
+			return fmt.Errorf("%w: %v: row %d of %d columns", ErrDimensionMismatch, in.Name, i, len(row))
+		}
+	}
+
+	if !u.IsUnitary(1e-10) {
+		return fmt.Errorf("%w: %v", ErrNotUnitary, in.Name)
+	}
+
+	return nil
+}
+
+// params is the number of parameters of the gates that have them.
+var params = map[string]int{
+	"r":  1,
+	"rx": 1,
+	"ry": 1,
+	"rz": 1,
+	"p":  1,
+	"u3": 3,
+	"u":  4,
+}
+
+// repeated returns the first qbit that appears more than once in the lists.
+func repeated(bit ...[]int) (int, bool) {
+	seen := map[int]bool{}
+	for _, list := range bit {
+		for _, b := range list {
+			if seen[b] {
+				return b, true
+			}
+			seen[b] = true
+		}
+	}
+
+	return 0, false
+}
+
+// holds returns true if the classical bits hold the value of the condition.
+func (q *Q) holds(c *Condition) bool {
+	v := 0
+	for i, b := range c.Clbit {
+		if b < len(q.clbit) && q.clbit[b] == 1 {
+			v = v | 1<<uint(i)
+		}
+	}
+
+	return v == c.Value
+}
+
+// bits returns the indices of all the qbits of the register.
+func (q *Q) bits() []int {
+	return append([]int{}, q.wire...)
+}
+
+// local returns the instruction on the positions of the qbits in the state,
+// which are not their indices once a qbit is released.
+func (q *Q) local(in Instruction) Instruction {
+	if len(q.wire) == len(q.pos) {
+		return in
+	}
+
+	position := func(bit []int) []int {
+		if bit == nil {
+			return nil
+		}
+
+		p := []int{}
+		for _, b := range bit {
+			p = append(p, q.pos[b])
+		}
+		return p
+	}
+
+	in.Target = position(in.Target)
+	in.Control = position(in.Control)
+	in.Open = position(in.Open)
+	return in
+}
+
+// controlled applies the matrix to the target bits
+// and then the errors of the noise model for the gate.
+func (q *Q) controlled(name string, u matrix.Matrix, control, open []int, target ...int) {
+	q.state.ApplyControlled(u, control, open, target...)
+
+	if len(control)+len(open) > 0 {
+		name = "c" + name
+	}
+
+	bit := append(append([]int{}, target...), control...)
+	q.applyNoise(name, append(bit, open...)...)
+}
+
+func (q *Q) swap(b0, b1 int) {
+	q.state.Swap(b0, b1)
+	q.applyNoise("swap", b0, b1)
+}
+
+// qft applies the Quantum Fourier Transformation to the bits
+// as the same sequence of H, CR and Swap gates that gate.QFT multiplies.
+func (q *Q) qft(bit []int) {
+	n := len(bit)
+	for i := 0; i < n; i++ {
+		q.controlled("h", gate.H(), nil, nil, bit[i])
+
+		k := 2
+		for j := i + 1; j < n; j++ {
+			q.controlled("r", gate.R(k), []int{bit[j]}, nil, bit[i])
+			k++
+		}
+	}
+
+	for i := 0; i < n/2; i++ {
+		q.swap(bit[i], bit[n-1-i])
+	}
+}
+
+// iqft applies the gates of qft daggered in reverse order.
+func (q *Q) iqft(bit []int) {
+	n := len(bit)
+	for i := 0; i < n/2; i++ {
+		q.swap(bit[i], bit[n-1-i])
+	}
+
+	for i := n - 1; i > -1; i-- {
+		k := n - i
+		for j := n - 1; j > i; j-- {
+			q.controlled("r", gate.R(k).Dagger(), []int{bit[j]}, nil, bit[i])
+			k--
+		}
+
+		q.controlled("h", gate.H(), nil, nil, bit[i])
+	}
+}
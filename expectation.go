@@ -0,0 +1,153 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/pauli"
+)
+
+// ErrNotHermitian is returned when an observable is not Hermitian.
+var ErrNotHermitian = errors.New("q: observable is not Hermitian")
+
+// Expectation returns the expectation value of the observable, a weighted sum
+// of Pauli strings on the qbits of the same indices such as
+// pauli.MustParse("0.5*Z0Z1 - 1.2*X2"). It is computed from the state,
+// which is not measured. It returns 0 if Err is not nil.
+func (q *Q) Expectation(obs pauli.Sum) float64 {
+	if !q.observable(obs) {
+		return 0
+	}
+
+	sum := 0.0
+	for _, p := range obs {
+		u, target := []matrix.Matrix{}, [][]int{}
+		for _, b := range p.Qubits() {
+			u = append(u, pauli.Matrix(p.Ops[b]))
+			target = append(target, []int{q.pos[b]})
+		}
+
+		if len(u) == 0 {
+			sum = sum + real(p.Coef)
+			continue
+		}
+
+		sum = sum + real(p.Coef)*real(q.state.Expectation(u, target))
+	}
+
+	return sum
+}
+
+// ExpectationMatrix returns the expectation value of the Hermitian
+// 2^k x 2^k matrix on the k qbits, the first qbit being the most
+// significant bit of the matrix. Err is ErrNotHermitian if it is not.
+// It returns 0 if Err is not nil.
+func (q *Q) ExpectationMatrix(obs matrix.Matrix, input ...*Qubit) float64 {
+	bit := q.index(input)
+	if q.err != nil {
+		return 0
+	}
+
+	if err := q.check(Instruction{Name: "expectation", Target: bit}); err != nil {
+		q.fail(err)
+		return 0
+	}
+
+	if r, c := obs.Dimension(); r != c || r != 1<<uint(len(bit)) {
+		q.fail(fmt.Errorf("%w: expectation: matrix of dimension %dx%d on %d qbits", ErrDimensionMismatch, r, c, len(bit)))
+		return 0
+	}
+
+	if !obs.IsHermite(1e-10) {
+		q.fail(ErrNotHermitian)
+		return 0
+	}
+
+	target := []int{}
+	for _, b := range bit {
+		target = append(target, q.pos[b])
+	}
+
+	return real(q.state.Expectation([]matrix.Matrix{obs}, [][]int{target}))
+}
+
+// EstimateExpectation estimates the expectation value of the observable
+// from shots measurements of each Pauli string in its own basis,
+// as on a device. The register is not changed.
+// It returns 0 if Err is not nil.
+func (q *Q) EstimateExpectation(obs pauli.Sum, shots int) float64 {
+	if shots < 1 {
+		q.fail(fmt.Errorf("q: expectation: %d shots", shots))
+	}
+
+	if !q.observable(obs) {
+		return 0
+	}
+
+	sum := 0.0
+	for _, p := range obs {
+		bit := p.Qubits()
+		if len(bit) == 0 {
+			sum = sum + real(p.Coef)
+			continue
+		}
+
+		// rotate X and Y to Z
+		s := q.state.Clone()
+		for _, b := range bit {
+			switch p.Ops[b] {
+			case 'X':
+				s.ApplyAt(gate.H(), q.pos[b])
+			case 'Y':
+				s.ApplyAt(gate.S().Dagger(), q.pos[b])
+				s.ApplyAt(gate.H(), q.pos[b])
+			}
+		}
+
+		// the eigenvalue of each shot is the parity of the bits
+		total := 0
+		for _, shot := range q.sample(s, shots) {
+			parity := 1
+			for _, b := range bit {
+				one := shot[q.pos[b]]
+				if q.misread(b, one) {
+					one = !one
+				}
+				if one {
+					parity = -parity
+				}
+			}
+			total = total + parity
+		}
+
+		sum = sum + real(p.Coef)*float64(total)/float64(shots)
+	}
+
+	return sum
+}
+
+// observable returns true if the Pauli strings are Hermitian
+// and act on the qbits of the register, and keeps the error for Err if not.
+func (q *Q) observable(obs pauli.Sum) bool {
+	if q.err != nil {
+		return false
+	}
+
+	if !obs.IsHermite() {
+		q.fail(fmt.Errorf("%w: %v", ErrNotHermitian, obs))
+		return false
+	}
+
+	for _, p := range obs {
+		for _, b := range p.Qubits() {
+			if b >= len(q.pos) || q.pos[b] < 0 {
+				q.fail(fmt.Errorf("%w: %v: %d", ErrQubitOutOfRange, p, b))
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,220 @@
+package q
+
+import (
+	"math/rand"
+
+	"github.com/axamon/q/density"
+	"github.com/axamon/q/matrix"
+)
+
+// fusion is a Backend that merges the gates on at most k qbits into one
+// unitary before they reach the backend it wraps. Gates on disjoint qbits
+// commute, so the pending blocks are kept disjoint and each is applied
+// once a gate, a channel or a measurement on its qbits cannot be merged.
+type fusion struct {
+	state   Backend
+	k       int
+	pending []block
+}
+
+// block is the unitary of the gates merged on the qbits of bit,
+// bit[0] being its most significant bit.
+type block struct {
+	bit []int
+	u   matrix.Matrix
+}
+
+func (s *fusion) Add(z ...complex128) error {
+	s.flush()
+	return s.state.Add(z...)
+}
+
+func (s *fusion) NumberOfBit() int {
+	return s.state.NumberOfBit()
+}
+
+func (s *fusion) ApplyAt(u matrix.Matrix, target int, control ...int) {
+	s.apply(u, control, nil, []int{target})
+}
+
+func (s *fusion) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) {
+	s.apply(u, control, open, target)
+}
+
+// apply merges the gate with the pending blocks on its qbits,
+// or applies them and keeps the gate on its own if the merged block
+// would act on more than k qbits.
+func (s *fusion) apply(u matrix.Matrix, control, open, target []int) {
+	bit := append(append(append([]int{}, control...), open...), target...)
+	if len(bit) > s.k {
+		s.flush(bit...)
+		s.state.ApplyControlled(u, control, open, target...)
+		return
+	}
+
+	over, rest := []block{}, []block{}
+	union := []int{}
+	for _, b := range s.pending {
+		if !overlaps(b.bit, bit) {
+			rest = append(rest, b)
+			continue
+		}
+
+		over = append(over, b)
+		union = append(union, b.bit...)
+	}
+
+	for _, b := range bit {
+		if !overlaps(union, []int{b}) {
+			union = append(union, b)
+		}
+	}
+
+	if len(union) > s.k {
+		s.flush(bit...)
+		s.pending = append(s.pending, block{bit, embed(u, target, control, open, bit)})
+		return
+	}
+
+	// the blocks commute with each other and precede the gate
+	m := embed(u, target, control, open, union)
+	for _, b := range over {
+		m = embed(b.u, b.bit, nil, nil, union).Apply(m)
+	}
+
+	s.pending = append(rest, block{union, m})
+}
+
+// flush applies the pending blocks on any of the qbits, all of them without qbits.
+func (s *fusion) flush(bit ...int) {
+	rest := []block{}
+	for _, b := range s.pending {
+		if len(bit) > 0 && !overlaps(b.bit, bit) {
+			rest = append(rest, b)
+			continue
+		}
+
+		s.state.ApplyControlled(b.u, nil, nil, b.bit...)
+	}
+
+	s.pending = rest
+}
+
+func (s *fusion) ApplyKraus(k []matrix.Matrix, target int) {
+	s.flush(target)
+	s.state.ApplyKraus(k, target)
+}
+
+func (s *fusion) Swap(b0, b1 int) {
+	s.flush(b0, b1)
+	s.state.Swap(b0, b1)
+}
+
+func (s *fusion) Measure(bit int) bool {
+	s.flush(bit)
+	return s.state.Measure(bit)
+}
+
+func (s *fusion) Probability() []float64 {
+	s.flush()
+	return s.state.Probability()
+}
+
+func (s *fusion) DensityMatrix() *density.Matrix {
+	s.flush()
+	return s.state.DensityMatrix()
+}
+
+func (s *fusion) Clone() Backend {
+	s.flush()
+	return &fusion{state: s.state.Clone(), k: s.k}
+}
+
+func (s *fusion) Release(bit int) error {
+	s.flush()
+	return s.state.Release(bit)
+}
+
+func (s *fusion) Expectation(u []matrix.Matrix, target [][]int) complex128 {
+	s.flush()
+	return s.state.Expectation(u, target)
+}
+
+func (s *fusion) Rand(src rand.Source) {
+	s.state.Rand(src)
+}
+
+// overlaps returns true if the lists of qbits have one in common.
+func overlaps(b0, b1 []int) bool {
+	for _, x := range b0 {
+		for _, y := range b1 {
+			if x == y {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// embed returns the matrix on the qbits of onto, onto[0] being its most
+// significant bit, that applies u to the targets when the controls are |1>
+// and the open controls |0>, and the identity to the other qbits.
+func embed(u matrix.Matrix, target, control, open, onto []int) matrix.Matrix {
+	n := len(onto)
+	mask := func(bit int) int {
+		for i, b := range onto {
+			if b == bit {
+				return 1 << uint(n-1-i)
+			}
+		}
+		return 0
+	}
+
+	t, all := []int{}, 0
+	for _, b := range target {
+		t = append(t, mask(b))
+		all = all | mask(b)
+	}
+
+	c, o := 0, 0
+	for _, b := range control {
+		c = c | mask(b)
+	}
+	for _, b := range open {
+		o = o | mask(b)
+	}
+
+	// index returns the index in u of the targets of i
+	index := func(i int) int {
+		x := 0
+		for _, m := range t {
+			x = x << 1
+			if i&m != 0 {
+				x = x | 1
+			}
+		}
+		return x
+	}
+
+	out := make(matrix.Matrix, 1<<uint(n))
+	for r := range out {
+		out[r] = make([]complex128, 1<<uint(n))
+		for col := range out[r] {
+			if r&^all != col&^all {
+				continue
+			}
+
+			if r&c != c || r&o != 0 {
+				if r == col {
+					out[r][col] = 1
+				}
+				continue
+			}
+
+			out[r][col] = u[index(r)][index(col)]
+		}
+	}
+
+	return out
+}
@@ -1,10 +1,8 @@
 package gate
 
 import (
-	"fmt"
 	"math"
 	"math/cmplx"
-	"strconv"
 
 	"github.com/axamon/q/matrix"
 )
@@ -110,35 +108,109 @@ func T(bit ...int) matrix.Matrix {
 	return matrix.TensorProductN(m, bit...)
 }
 
-func ControlledR(bit int, c []int, t, k int) matrix.Matrix {
-	m := I([]int{bit}...)
-	dim := len(m)
+// RX is the rotation by theta about the x axis of the Bloch sphere.
+func RX(theta float64, bit ...int) matrix.Matrix {
+	m := make(matrix.Matrix, 2)
+	v := complex(math.Cos(theta/2), 0)
+	w := complex(0, -math.Sin(theta/2))
+	m[0] = []complex128{v, w}
+	m[1] = []complex128{w, v}
+	return matrix.TensorProductN(m, bit...)
+}
 
-	p := 2 * math.Pi / math.Pow(2, float64(k))
-	e := cmplx.Exp(complex(0, p))
+// RY is the rotation by theta about the y axis of the Bloch sphere.
+func RY(theta float64, bit ...int) matrix.Matrix {
+	m := make(matrix.Matrix, 2)
+	v := complex(math.Cos(theta/2), 0)
+	w := complex(math.Sin(theta/2), 0)
+	m[0] = []complex128{v, -1 * w}
+	m[1] = []complex128{w, v}
+	return matrix.TensorProductN(m, bit...)
+}
 
-	f := "%0" + strconv.Itoa(bit) + "s"
+// RZ is the rotation by theta about the z axis of the Bloch sphere.
+func RZ(theta float64, bit ...int) matrix.Matrix {
+	m := make(matrix.Matrix, 2)
+	v := cmplx.Exp(complex(0, theta/2))
+	m[0] = []complex128{cmplx.Conj(v), 0}
+	m[1] = []complex128{0, v}
+	return matrix.TensorProductN(m, bit...)
+}
+
+// Phase is the phase shift gate. Phase(pi/2) is S and Phase(pi/4) is T.
+func Phase(lambda float64, bit ...int) matrix.Matrix {
+	m := make(matrix.Matrix, 2)
+	m[0] = []complex128{1, 0}
+	m[1] = []complex128{0, cmplx.Exp(complex(0, lambda))}
+	return matrix.TensorProductN(m, bit...)
+}
+
+// U3 is the generic single qubit gate of OpenQASM
+// equal to RZ(phi)RY(theta)RZ(lambda) up to a global phase.
+func U3(theta, phi, lambda float64, bit ...int) matrix.Matrix {
+	m := make(matrix.Matrix, 2)
+	v := complex(math.Cos(theta/2), 0)
+	w := complex(math.Sin(theta/2), 0)
+	m[0] = []complex128{v, -1 * cmplx.Exp(complex(0, lambda)) * w}
+	m[1] = []complex128{cmplx.Exp(complex(0, phi)) * w, cmplx.Exp(complex(0, phi+lambda)) * v}
+	return matrix.TensorProductN(m, bit...)
+}
+
+// Controlled returns the matrix of the 2^k x 2^k unitary u on the k target
+// qubits t of a register of bit qubits, applied when the qubits c are |1>.
+func Controlled(u matrix.Matrix, bit int, c []int, t ...int) matrix.Matrix {
+	dim := 1 << uint(bit)
+	mask := func(b int) int { return 1 << uint(bit-1-b) }
+
+	// tmask are the target bits, sub the index of u of a basis state
+	tmask := 0
+	for _, b := range t {
+		tmask = tmask | mask(b)
+	}
+
+	sub := func(i int) int {
+		s := 0
+		for _, b := range t {
+			s = s << 1
+			if i&mask(b) != 0 {
+				s = s | 1
+			}
+		}
+		return s
+	}
+
+	m := make(matrix.Matrix, dim)
 	for i := 0; i < dim; i++ {
-		s := fmt.Sprintf(f, strconv.FormatInt(int64(i), 2))
-		bits := []rune(s)
+		m[i] = make([]complex128, dim)
 
-		// Apply R(k)
 		apply := true
-		for i := range c {
-			if bits[c[i]] == '0' {
+		for _, b := range c {
+			if i&mask(b) == 0 {
 				apply = false
 				break
 			}
 		}
 
-		if apply && bits[t] == '1' {
-			m[i][i] = e * m[i][i]
+		if !apply {
+			m[i][i] = 1
+			continue
+		}
+
+		// the columns that differ from the row only in the target bits
+		for j := 0; j < dim; j++ {
+			if i&^tmask == j&^tmask {
+				m[i][j] = u[sub(i)][sub(j)]
+			}
 		}
 	}
 
 	return m
 }
 
+func ControlledR(bit int, c []int, t, k int) matrix.Matrix {
+	return Controlled(R(k), bit, c, t)
+}
+
 func CR(bit, c, t, k int) matrix.Matrix {
 	return ControlledR(bit, []int{c}, t, k)
 }
@@ -147,46 +219,7 @@ func CR(bit, c, t, k int) matrix.Matrix {
 // which flips the second qubit (t the target qubit) if and only if
 // the first qubit (c the control qubit) is |1>
 func ControlledNot(bit int, c []int, t int) matrix.Matrix {
-	m := I([]int{bit}...)
-	dim := len(m)
-
-	index := []int64{}
-	f := "%0" + strconv.Itoa(bit) + "s"
-	for i := 0; i < dim; i++ {
-		s := fmt.Sprintf(f, strconv.FormatInt(int64(i), 2))
-		bits := []rune(s)
-
-		// Apply X
-		apply := true
-		for i := range c {
-			if bits[c[i]] == '0' {
-				apply = false
-				break
-			}
-		}
-
-		if apply {
-			if bits[t] == '0' {
-				bits[t] = '1'
-			} else {
-				bits[t] = '0'
-			}
-		}
-
-		v, err := strconv.ParseInt(string(bits), 2, 0)
-		if err != nil {
-			panic(err)
-		}
-
-		index = append(index, v)
-	}
-
-	cnot := make(matrix.Matrix, dim)
-	for i, ii := range index {
-		cnot[i] = m[ii]
-	}
-
-	return cnot
+	return Controlled(X(), bit, c, t)
 }
 
 func Toffoli() matrix.Matrix {
@@ -198,29 +231,7 @@ func CNOT(bit, c, t int) matrix.Matrix {
 }
 
 func ControlledZ(bit int, c []int, t int) matrix.Matrix {
-	m := I([]int{bit}...)
-	dim := len(m)
-
-	f := "%0" + strconv.Itoa(bit) + "s"
-	for i := 0; i < dim; i++ {
-		s := fmt.Sprintf(f, strconv.FormatInt(int64(i), 2))
-		bits := []rune(s)
-
-		// Apply Z
-		apply := true
-		for i := range c {
-			if bits[c[i]] == '0' {
-				apply = false
-				break
-			}
-		}
-
-		if apply && bits[t] == '1' {
-			m[i][i] = complex(-1, 0) * m[i][i]
-		}
-	}
-
-	return m
+	return Controlled(Z(), bit, c, t)
 }
 
 func CZ(bit, c, t int) matrix.Matrix {
@@ -228,29 +239,7 @@ func CZ(bit, c, t int) matrix.Matrix {
 }
 
 func ControlledS(bit int, c []int, t int) matrix.Matrix {
-	m := I([]int{bit}...)
-	dim := len(m)
-
-	f := "%0" + strconv.Itoa(bit) + "s"
-	for i := 0; i < dim; i++ {
-		s := fmt.Sprintf(f, strconv.FormatInt(int64(i), 2))
-		bits := []rune(s)
-
-		// Apply S
-		apply := true
-		for i := range c {
-			if bits[c[i]] == '0' {
-				apply = false
-				break
-			}
-		}
-
-		if apply && bits[t] == '1' {
-			m[i][i] = 1i * m[i][i]
-		}
-	}
-
-	return m
+	return Controlled(S(), bit, c, t)
 }
 
 func CS(bit, c, t int) matrix.Matrix {
@@ -2,6 +2,7 @@ package gate_test
 
 import (
 	"fmt"
+	"math"
 	"math/cmplx"
 	"testing"
 
@@ -152,6 +153,35 @@ func TestInverseU(t *testing.T) {
 	}
 }
 
+func TestRotation(t *testing.T) {
+	theta, phi, lambda := 0.3, 1.2, -0.7
+
+	var test = []struct {
+		m0, m1 matrix.Matrix
+	}{
+		{gate.RX(math.Pi), gate.X().Mul(-1i)},
+		{gate.RY(math.Pi), gate.Y().Mul(-1i)},
+		{gate.RZ(math.Pi), gate.Z().Mul(-1i)},
+		{gate.RZ(theta), gate.Phase(theta).Mul(cmplx.Exp(complex(0, -theta/2)))},
+		{gate.Phase(math.Pi / 2), gate.S()},
+		{gate.Phase(math.Pi / 4), gate.T()},
+		{gate.U3(math.Pi/2, 0, math.Pi), gate.H()},
+		{gate.U3(theta, -math.Pi/2, math.Pi/2), gate.RX(theta)},
+		{gate.U3(theta, phi, lambda), gate.RZ(lambda).Apply(gate.RY(theta)).Apply(gate.RZ(phi)).Mul(cmplx.Exp(complex(0, (phi+lambda)/2)))},
+		{gate.RX(theta, 2), matrix.TensorProduct(gate.RX(theta), gate.RX(theta))},
+	}
+
+	for _, tt := range test {
+		if !tt.m0.IsUnitary(1e-13) {
+			t.Errorf("%v\n", tt.m0)
+		}
+
+		if !tt.m0.Equals(tt.m1, 1e-13) {
+			t.Errorf("%v: %v\n", tt.m0, tt.m1)
+		}
+	}
+}
+
 func TestCZ(t *testing.T) {
 	expected := gate.New(
 		[]complex128{1, 0, 0, 0, 0, 0, 0, 0},
@@ -200,6 +230,25 @@ func TestControlledNot(t *testing.T) {
 	}
 }
 
+func TestControlled(t *testing.T) {
+	var test = []struct {
+		actual   matrix.Matrix
+		expected matrix.Matrix
+	}{
+		{gate.Controlled(gate.X(), 3, []int{0, 1}, 2), gate.Toffoli()},
+		{gate.Controlled(gate.Swap(2, 0, 1), 3, []int{0}, 1, 2), gate.Fredkin()},
+		{gate.Controlled(gate.CNOT(2, 0, 1), 3, []int{}, 2, 0), gate.CNOT(3, 2, 0)},
+		{gate.Controlled(gate.H(), 2, []int{}, 1), matrix.TensorProduct(gate.I(), gate.H())},
+		{gate.Controlled(gate.S(), 2, []int{1}, 0), gate.CS(2, 1, 0)},
+	}
+
+	for _, tt := range test {
+		if !tt.actual.Equals(tt.expected, 1e-13) {
+			t.Errorf("%v: %v", tt.actual, tt.expected)
+		}
+	}
+}
+
 func TestToffoli(t *testing.T) {
 	g := make([]matrix.Matrix, 13)
 
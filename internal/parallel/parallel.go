@@ -0,0 +1,122 @@
+// Package parallel splits the loops over the amplitudes of large
+// registers across goroutines.
+package parallel
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Threshold is the length below which the loops run on the calling goroutine,
+// where starting the goroutines would cost more than the loop.
+const Threshold = 1 << 14
+
+// Workers returns n, or the number of CPUs Go uses if n < 1.
+func Workers(n int) int {
+	if n < 1 {
+		return runtime.GOMAXPROCS(0)
+	}
+
+	return n
+}
+
+// chunks returns the number of ranges [0, n) is split into.
+func chunks(n, workers int) int {
+	w := Workers(workers)
+	if n < Threshold || w == 1 {
+		return 1
+	}
+
+	if w > n {
+		return n
+	}
+
+	return w
+}
+
+// For calls f on contiguous ranges [lo, hi) that cover [0, n),
+// on up to workers goroutines when n is at least Threshold,
+// and returns when they are done.
+func For(n, workers int, f func(lo, hi int)) {
+	split(n, chunks(n, workers), func(i, lo, hi int) { f(lo, hi) })
+}
+
+// Rows is For over m rows of cols elements each,
+// which runs in parallel when m*cols is at least Threshold.
+func Rows(m, cols, workers int, f func(lo, hi int)) {
+	c := chunks(m*cols, workers)
+	if c > m {
+		c = m
+	}
+
+	split(m, c, func(i, lo, hi int) { f(lo, hi) })
+}
+
+// Sum returns the sum of f over the ranges of For.
+// The partial sums are added in order, so the result depends
+// on the number of workers but not on the scheduling.
+func Sum(n, workers int, f func(lo, hi int) float64) float64 {
+	c := chunks(n, workers)
+	part := make([]float64, c)
+	split(n, c, func(i, lo, hi int) { part[i] = f(lo, hi) })
+
+	var sum float64
+	for _, p := range part {
+		sum = sum + p
+	}
+
+	return sum
+}
+
+// split calls f on the c ranges of [0, n) with their index.
+func split(n, c int, f func(i, lo, hi int)) {
+	if c == 1 {
+		f(0, 0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(c)
+	for i := 0; i < c; i++ {
+		go func(i int) {
+			defer wg.Done()
+			f(i, i*n/c, (i+1)*n/c)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// CumSum returns the cumulative sums of p. Each range of For is summed
+// on its own goroutine and then offset by the sum of the ranges before it.
+func CumSum(p []float64, workers int) []float64 {
+	n := len(p)
+	c := chunks(n, workers)
+
+	out := make([]float64, n)
+	part := make([]float64, c)
+	split(n, c, func(i, lo, hi int) {
+		var sum float64
+		for j := lo; j < hi; j++ {
+			sum = sum + p[j]
+			out[j] = sum
+		}
+		part[i] = sum
+	})
+
+	if c == 1 {
+		return out
+	}
+
+	off := make([]float64, c)
+	for i := 1; i < c; i++ {
+		off[i] = off[i-1] + part[i-1]
+	}
+
+	split(n, c, func(i, lo, hi int) {
+		for j := lo; j < hi; j++ {
+			out[j] = out[j] + off[i]
+		}
+	})
+
+	return out
+}
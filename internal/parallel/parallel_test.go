@@ -0,0 +1,69 @@
+package parallel
+
+import "testing"
+
+func TestFor(t *testing.T) {
+	for _, n := range []int{0, 1, Threshold - 1, Threshold, 3*Threshold + 7} {
+		for _, w := range []int{0, 1, 3, 8} {
+			seen := make([]int, n)
+			For(n, w, func(lo, hi int) {
+				for i := lo; i < hi; i++ {
+					seen[i]++
+				}
+			})
+
+			for i := range seen {
+				if seen[i] != 1 {
+					t.Fatal(n, w, i, seen[i])
+				}
+			}
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	n := 3*Threshold + 7
+	for _, w := range []int{1, 3, 8} {
+		got := Sum(n, w, func(lo, hi int) float64 {
+			return float64(hi - lo)
+		})
+
+		if got != float64(n) {
+			t.Error(w, got)
+		}
+	}
+}
+
+func TestRows(t *testing.T) {
+	for _, m := range []int{1, 4, 1000} {
+		seen := make([]int, m)
+		Rows(m, Threshold, 8, func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				seen[i]++
+			}
+		})
+
+		for i := range seen {
+			if seen[i] != 1 {
+				t.Fatal(m, i, seen[i])
+			}
+		}
+	}
+}
+
+func TestCumSum(t *testing.T) {
+	n := 3*Threshold + 7
+	p := make([]float64, n)
+	for i := range p {
+		p[i] = 1
+	}
+
+	for _, w := range []int{1, 3, 8} {
+		out := CumSum(p, w)
+		for i := range out {
+			if out[i] != float64(i+1) {
+				t.Fatal(w, i, out[i])
+			}
+		}
+	}
+}
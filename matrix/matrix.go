@@ -1,8 +1,21 @@
 package matrix
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"math/cmplx"
+	"sort"
+
+	"github.com/axamon/q/internal/parallel"
+)
+
+var (
+	// ErrDimensionMismatch is returned when the matrix is not square.
+	ErrDimensionMismatch = errors.New("matrix: dimension mismatch")
+
+	// ErrSingular is returned when the matrix has no inverse.
+	ErrSingular = errors.New("matrix: singular matrix")
 )
 
 // Matrix type manages complex numbers in matrices.
@@ -44,6 +57,10 @@ func (m0 Matrix) Equals(m1 Matrix, eps ...float64) bool {
 
 // Dimension returns the dimensions of the matrix.
 func (m0 Matrix) Dimension() (int, int) {
+	if len(m0) == 0 {
+		return 0, 0
+	}
+
 	return len(m0), len(m0[0])
 }
 
@@ -52,9 +69,9 @@ func (m0 Matrix) Transpose() Matrix {
 	p, q := m0.Dimension()
 
 	m2 := Matrix{}
-	for i := 0; i < p; i++ {
+	for i := 0; i < q; i++ {
 		v := []complex128{}
-		for j := 0; j < q; j++ {
+		for j := 0; j < p; j++ {
 			v = append(v, m0[j][i])
 		}
 		m2 = append(m2, v)
@@ -126,22 +143,31 @@ func (m0 Matrix) IsUnitary(eps ...float64) bool {
 }
 
 // Apply returns a matrix that is the result of aplying the two matrices together.
-func (m0 Matrix) Apply(m1 Matrix) Matrix {
-	m, n := m1.Dimension()
-	p, _ := m0.Dimension()
+// The rows of large matrices are split across the optional number of
+// goroutines, one per CPU by default.
+func (m0 Matrix) Apply(m1 Matrix, workers ...int) Matrix {
+	m, _ := m1.Dimension()
+	p, n := m0.Dimension()
+
+	w := 0
+	if len(workers) > 0 {
+		w = workers[0]
+	}
 
-	m2 := Matrix{}
-	for i := 0; i < m; i++ {
-		v := []complex128{}
-		for j := 0; j < n; j++ {
-			c := complex(0, 0)
-			for k := 0; k < p; k++ {
-				c = c + m1[i][k]*m0[k][j]
+	m2 := make(Matrix, m)
+	parallel.Rows(m, n*p, w, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			v := make([]complex128, n)
+			for j := 0; j < n; j++ {
+				c := complex(0, 0)
+				for k := 0; k < p; k++ {
+					c = c + m1[i][k]*m0[k][j]
+				}
+				v[j] = c
 			}
-			v = append(v, c)
+			m2[i] = v
 		}
-		m2 = append(m2, v)
-	}
+	})
 
 	return m2
 }
@@ -223,12 +249,26 @@ func (m0 Matrix) Clone() Matrix {
 }
 
 // Inverse returns the inverse of the matrix.
+// It panics if the matrix is not square or has no inverse, see TryInverse.
 func (m0 Matrix) Inverse() Matrix {
-	mat := m0.Clone()
-	m, n := mat.Dimension()
-	if m != n {
-		panic(fmt.Sprintf("m=%d n=%d", m, n))
+	inv, err := m0.TryInverse()
+	if err != nil {
+		panic(err)
+	}
+
+	return inv
+}
+
+// TryInverse returns the inverse of the matrix, ErrDimensionMismatch
+// if it is not square or ErrSingular if it has no inverse.
+func (m0 Matrix) TryInverse() (Matrix, error) {
+	m, n := m0.Dimension()
+	for _, r := range m0 {
+		if len(r) != n || m != n {
+			return nil, fmt.Errorf("%w: m=%d n=%d", ErrDimensionMismatch, m, len(r))
+		}
 	}
+	mat := m0.Clone()
 
 	inv := Matrix{}
 	for i := 0; i < m; i++ {
@@ -244,6 +284,19 @@ func (m0 Matrix) Inverse() Matrix {
 	}
 
 	for i := 0; i < m; i++ {
+		// the row with the largest pivot
+		p := i
+		for j := i + 1; j < m; j++ {
+			if cmplx.Abs(mat[j][i]) > cmplx.Abs(mat[p][i]) {
+				p = j
+			}
+		}
+		if mat[p][i] == 0 {
+			return nil, ErrSingular
+		}
+		mat[i], mat[p] = mat[p], mat[i]
+		inv[i], inv[p] = inv[p], inv[i]
+
 		c := 1 / mat[i][i]
 		for j := 0; j < n; j++ {
 			mat[i][j] = c * mat[i][j]
@@ -261,7 +314,105 @@ func (m0 Matrix) Inverse() Matrix {
 		}
 	}
 
-	return inv
+	return inv, nil
+}
+
+// SVD returns the singular value decomposition m0 = U diag(s) V^dagger
+// with the singular values in decreasing order, computed by one-sided
+// Jacobi rotations. U is m x k and V is n x k for k = min(m, n).
+// The columns of U of a zero singular value are zero.
+func (m0 Matrix) SVD() (Matrix, []float64, Matrix) {
+	m, n := m0.Dimension()
+	if n > m {
+		u, s, v := m0.Dagger().SVD()
+		return v, s, u
+	}
+
+	a := m0.Clone()
+	v := make(Matrix, n)
+	for i := range v {
+		v[i] = make([]complex128, n)
+		v[i][i] = 1
+	}
+
+	for sweep := 0; sweep < 64; sweep++ {
+		rotated := false
+		for p := 0; p < n-1; p++ {
+			for q := p + 1; q < n; q++ {
+				var alpha, beta float64
+				var gamma complex128
+				for i := 0; i < m; i++ {
+					alpha = alpha + real(a[i][p]*cmplx.Conj(a[i][p]))
+					beta = beta + real(a[i][q]*cmplx.Conj(a[i][q]))
+					gamma = gamma + cmplx.Conj(a[i][p])*a[i][q]
+				}
+
+				g := cmplx.Abs(gamma)
+				if g == 0 || g <= 1e-15*math.Sqrt(alpha*beta) {
+					continue
+				}
+				rotated = true
+
+				// the rotation of the columns p and e^-iphi q that makes them orthogonal
+				phase := cmplx.Conj(gamma / complex(g, 0))
+				zeta := (beta - alpha) / (2 * g)
+				t := 1 / (math.Abs(zeta) + math.Sqrt(1+zeta*zeta))
+				if zeta < 0 {
+					t = -t
+				}
+				c := complex(1/math.Sqrt(1+t*t), 0)
+				s := c * complex(t, 0)
+
+				for _, w := range []Matrix{a, v} {
+					for i := range w {
+						wp, wq := w[i][p], w[i][q]*phase
+						w[i][p] = c*wp - s*wq
+						w[i][q] = s*wp + c*wq
+					}
+				}
+			}
+		}
+
+		if !rotated {
+			break
+		}
+	}
+
+	sigma := make([]float64, n)
+	for j := 0; j < n; j++ {
+		for i := 0; i < m; i++ {
+			sigma[j] = sigma[j] + real(a[i][j]*cmplx.Conj(a[i][j]))
+		}
+		sigma[j] = math.Sqrt(sigma[j])
+	}
+
+	order := make([]int, n)
+	for j := range order {
+		order[j] = j
+	}
+	sort.SliceStable(order, func(i, j int) bool { return sigma[order[i]] > sigma[order[j]] })
+
+	u, vs, s := make(Matrix, m), make(Matrix, n), make([]float64, n)
+	for i := range u {
+		u[i] = make([]complex128, n)
+	}
+	for i := range vs {
+		vs[i] = make([]complex128, n)
+	}
+
+	for k, j := range order {
+		s[k] = sigma[j]
+		for i := 0; i < m; i++ {
+			if sigma[j] > 0 {
+				u[i][k] = a[i][j] / complex(sigma[j], 0)
+			}
+		}
+		for i := 0; i < n; i++ {
+			vs[i][k] = v[i][j]
+		}
+	}
+
+	return u, s, vs
 }
 
 // TensorProduct returns a matrix whose elements are the tensor product
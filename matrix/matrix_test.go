@@ -1,6 +1,7 @@
 package matrix_test
 
 import (
+	"errors"
 	"fmt"
 	"math/cmplx"
 	"testing"
@@ -228,3 +229,71 @@ func TestAntiCommutator(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestInverseError(t *testing.T) {
+	x := matrix.New([]complex128{0, 1}, []complex128{1, 0})
+	inv, err := x.TryInverse()
+	if err != nil || !inv.Equals(x) {
+		t.Errorf("%v: %v", inv, err)
+	}
+
+	var test = []struct {
+		m   matrix.Matrix
+		err error
+	}{
+		{matrix.New([]complex128{1, 2}), matrix.ErrDimensionMismatch},
+		{matrix.New([]complex128{1, 2}, []complex128{3}), matrix.ErrDimensionMismatch},
+		{matrix.New([]complex128{1, 2}, []complex128{2, 4}), matrix.ErrSingular},
+	}
+
+	for _, tt := range test {
+		if _, err := tt.m.TryInverse(); !errors.Is(err, tt.err) {
+			t.Errorf("%v: %v", tt.m, err)
+		}
+	}
+
+	defer func() {
+		if err, ok := recover().(error); !ok || !errors.Is(err, matrix.ErrSingular) {
+			t.Error(err)
+		}
+	}()
+	matrix.New([]complex128{1, 2}, []complex128{2, 4}).Inverse()
+}
+
+func TestSVD(t *testing.T) {
+	var test = []matrix.Matrix{
+		matrix.New([]complex128{1, 2}, []complex128{3, 4}),
+		matrix.New([]complex128{1, 1i, 0}, []complex128{0, 2, -1i}),
+		matrix.New([]complex128{1, 2}, []complex128{2, 4}, []complex128{1i, 2i}),
+		matrix.New([]complex128{0, 0}, []complex128{0, 0}),
+		matrix.New([]complex128{0.5, 0.5i, -0.5, 0.5}),
+	}
+
+	for _, m := range test {
+		u, s, v := m.SVD()
+		k := len(s)
+		for i := 1; i < k; i++ {
+			if s[i] > s[i-1] {
+				t.Errorf("%v: %v", m, s)
+			}
+		}
+
+		d := make(matrix.Matrix, k)
+		for i := range d {
+			d[i] = make([]complex128, k)
+			d[i][i] = complex(s[i], 0)
+		}
+
+		// U diag(s) V^dagger
+		if got := v.Dagger().Apply(d.Apply(u)); !got.Equals(m, 1e-13) {
+			t.Errorf("%v: %v", m, got)
+		}
+
+		vv := v.Apply(v.Dagger())
+		for i := range vv {
+			if cmplx.Abs(vv[i][i]-1) > 1e-13 {
+				t.Errorf("%v: %v", m, vv)
+			}
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package q
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+
+	"github.com/axamon/q/density"
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/qubit"
+)
+
+// mps is the matrix product state of the register. Each qbit is a site of
+// two matrices, for |0> and |1>, whose product along the sites is the
+// amplitude of a basis state. The sites left of the center are
+// left-orthonormal and the sites right of it right-orthonormal,
+// so that the center holds the norm.
+type mps struct {
+	site   [][2]matrix.Matrix
+	center int
+
+	// maxBond is the largest bond dimension, 0 for no limit. The singular
+	// values whose weight is below threshold are discarded.
+	maxBond   int
+	threshold float64
+
+	// truncation is the sum of the weights of the discarded singular values.
+	truncation float64
+
+	src rand.Source
+	rnd *rand.Rand
+}
+
+// mul returns the product m0 m1.
+func mul(m0, m1 matrix.Matrix) matrix.Matrix {
+	return m1.Apply(m0)
+}
+
+// norm returns the squared Frobenius norm of the matrix.
+func norm(m matrix.Matrix) float64 {
+	sum := 0.0
+	for i := range m {
+		for j := range m[i] {
+			sum = sum + real(m[i][j]*cmplx.Conj(m[i][j]))
+		}
+	}
+
+	return sum
+}
+
+func zeros(r, c int) matrix.Matrix {
+	m := make(matrix.Matrix, r)
+	for i := range m {
+		m[i] = make([]complex128, c)
+	}
+
+	return m
+}
+
+// float64 returns a random number in [0.0,1.0) from the source.
+func (s *mps) float64() float64 {
+	if s.rnd == nil {
+		return rand.Float64()
+	}
+
+	return s.rnd.Float64()
+}
+
+func (s *mps) Add(z ...complex128) error {
+	n := complex(math.Sqrt(real(z[0]*cmplx.Conj(z[0])+z[1]*cmplx.Conj(z[1]))), 0)
+	s.site = append(s.site, [2]matrix.Matrix{
+		matrix.New([]complex128{z[0] / n}),
+		matrix.New([]complex128{z[1] / n}),
+	})
+
+	return nil
+}
+
+func (s *mps) NumberOfBit() int {
+	return len(s.site)
+}
+
+// local applies the 2x2 matrix to the site, which keeps it orthonormal
+// if the matrix is unitary.
+func (s *mps) local(u matrix.Matrix, p int) {
+	a := s.site[p]
+	s.site[p] = [2]matrix.Matrix{
+		a[0].Mul(u[0][0]).Add(a[1].Mul(u[0][1])),
+		a[0].Mul(u[1][0]).Add(a[1].Mul(u[1][1])),
+	}
+}
+
+func (s *mps) ApplyAt(u matrix.Matrix, target int, control ...int) {
+	s.ApplyControlled(u, control, nil, target)
+}
+
+func (s *mps) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) {
+	if len(control)+len(open) == 0 && len(target) == 1 {
+		s.local(u, target[0])
+		return
+	}
+
+	for _, o := range open {
+		s.local(gate.X(), o)
+	}
+
+	// the targets first, then the controls
+	bit := append(append(append([]int{}, target...), control...), open...)
+	c := []int{}
+	for i := len(target); i < len(bit); i++ {
+		c = append(c, i)
+	}
+	t := []int{}
+	for i := range target {
+		t = append(t, i)
+	}
+	s.applyOn(gate.Controlled(u, len(bit), c, t...), bit)
+
+	for _, o := range open {
+		s.local(gate.X(), o)
+	}
+}
+
+// applyOn applies the matrix to the sites, the first one being
+// the most significant bit, after swapping them next to each other.
+// The swaps are undone afterwards.
+func (s *mps) applyOn(u matrix.Matrix, bit []int) {
+	at := append([]int{}, bit...)
+	base := at[0]
+	for _, b := range at {
+		if b < base {
+			base = b
+		}
+	}
+
+	swaps := []int{}
+	for j := range at {
+		for at[j] > base+j {
+			i := at[j] - 1
+			s.block(gate.Swap(2, 0, 1), i, 2)
+			swaps = append(swaps, i)
+
+			for k := j + 1; k < len(at); k++ {
+				if at[k] == i {
+					at[k] = i + 1
+				}
+			}
+			at[j] = i
+		}
+	}
+
+	s.block(u, base, len(bit))
+
+	for i := len(swaps) - 1; i > -1; i-- {
+		s.block(gate.Swap(2, 0, 1), swaps[i], 2)
+	}
+}
+
+// block applies the 2^m x 2^m matrix to the m sites from p. The sites are
+// contracted into one tensor and split again by singular value
+// decompositions truncated to the bond dimension and the threshold.
+func (s *mps) block(u matrix.Matrix, p, m int) {
+	s.moveTo(p)
+
+	theta := []matrix.Matrix{s.site[p][0], s.site[p][1]}
+	for k := 1; k < m; k++ {
+		next := []matrix.Matrix{}
+		for _, t := range theta {
+			next = append(next, mul(t, s.site[p+k][0]), mul(t, s.site[p+k][1]))
+		}
+		theta = next
+	}
+
+	l, r := theta[0].Dimension()
+	applied := make([]matrix.Matrix, len(theta))
+	for i := range applied {
+		applied[i] = zeros(l, r)
+		for j := range theta {
+			if u[i][j] != 0 {
+				applied[i] = applied[i].Add(theta[j].Mul(u[i][j]))
+			}
+		}
+	}
+	theta = applied
+
+	for k := 0; k < m-1; k++ {
+		half := len(theta) / 2
+		l, r := theta[0].Dimension()
+
+		// rows of the first bit and the left bond,
+		// columns of the other bits and the right bond
+		mat := zeros(2*l, half*r)
+		for b := 0; b < len(theta); b++ {
+			for i := 0; i < l; i++ {
+				for j := 0; j < r; j++ {
+					mat[(b/half)*l+i][(b%half)*r+j] = theta[b][i][j]
+				}
+			}
+		}
+
+		left, sigma, right := mat.SVD()
+		keep, scale := s.keep(sigma, true)
+
+		for b := 0; b < 2; b++ {
+			a := zeros(l, keep)
+			for i := 0; i < l; i++ {
+				copy(a[i], left[b*l+i][:keep])
+			}
+			s.site[p+k][b] = a
+		}
+
+		rest := make([]matrix.Matrix, half)
+		for b := range rest {
+			rest[b] = zeros(keep, r)
+			for a := 0; a < keep; a++ {
+				for j := 0; j < r; j++ {
+					rest[b][a][j] = complex(sigma[a]*scale, 0) * cmplx.Conj(right[b*r+j][a])
+				}
+			}
+		}
+		theta = rest
+	}
+
+	s.site[p+m-1] = [2]matrix.Matrix{theta[0], theta[1]}
+	s.center = p + m - 1
+}
+
+// keep returns the number of singular values to keep and the factor
+// that restores the norm of the kept ones. The weight of the discarded
+// values is added to the truncation error if truncate is true,
+// otherwise only the zero values are discarded.
+func (s *mps) keep(sigma []float64, truncate bool) (int, float64) {
+	total := 0.0
+	for _, v := range sigma {
+		total = total + v*v
+	}
+
+	if total == 0 {
+		return 1, 1
+	}
+
+	k := 0
+	for k < len(sigma) && sigma[k] > 1e-14*sigma[0] {
+		if truncate && (sigma[k]*sigma[k]/total < s.threshold || s.maxBond > 0 && k == s.maxBond) {
+			break
+		}
+		k++
+	}
+
+	if k == 0 {
+		k = 1
+	}
+
+	kept := 0.0
+	for _, v := range sigma[:k] {
+		kept = kept + v*v
+	}
+
+	if truncate {
+		s.truncation = s.truncation + (total-kept)/total
+	}
+
+	return k, math.Sqrt(total / kept)
+}
+
+// moveTo moves the center to the site p.
+func (s *mps) moveTo(p int) {
+	for s.center < p {
+		c := s.center
+		a := s.site[c]
+		l, r := a[0].Dimension()
+
+		mat := zeros(2*l, r)
+		for b := 0; b < 2; b++ {
+			for i := 0; i < l; i++ {
+				copy(mat[b*l+i], a[b][i])
+			}
+		}
+
+		left, sigma, right := mat.SVD()
+		keep, _ := s.keep(sigma, false)
+
+		// the site becomes left-orthonormal, S V^dagger moves right
+		for b := 0; b < 2; b++ {
+			m := zeros(l, keep)
+			for i := 0; i < l; i++ {
+				copy(m[i], left[b*l+i][:keep])
+			}
+			s.site[c][b] = m
+		}
+
+		sv := zeros(keep, r)
+		for i := 0; i < keep; i++ {
+			for j := 0; j < r; j++ {
+				sv[i][j] = complex(sigma[i], 0) * cmplx.Conj(right[j][i])
+			}
+		}
+		s.site[c+1] = [2]matrix.Matrix{mul(sv, s.site[c+1][0]), mul(sv, s.site[c+1][1])}
+		s.center++
+	}
+
+	for s.center > p {
+		c := s.center
+		a := s.site[c]
+		l, r := a[0].Dimension()
+
+		mat := zeros(l, 2*r)
+		for b := 0; b < 2; b++ {
+			for i := 0; i < l; i++ {
+				copy(mat[i][b*r:], a[b][i])
+			}
+		}
+
+		left, sigma, right := mat.SVD()
+		keep, _ := s.keep(sigma, false)
+
+		// the site becomes right-orthonormal, U S moves left
+		for b := 0; b < 2; b++ {
+			m := zeros(keep, r)
+			for i := 0; i < keep; i++ {
+				for j := 0; j < r; j++ {
+					m[i][j] = cmplx.Conj(right[b*r+j][i])
+				}
+			}
+			s.site[c][b] = m
+		}
+
+		us := zeros(l, keep)
+		for i := 0; i < l; i++ {
+			for j := 0; j < keep; j++ {
+				us[i][j] = left[i][j] * complex(sigma[j], 0)
+			}
+		}
+		s.site[c-1] = [2]matrix.Matrix{mul(s.site[c-1][0], us), mul(s.site[c-1][1], us)}
+		s.center--
+	}
+}
+
+func (s *mps) ApplyKraus(k []matrix.Matrix, target int) {
+	s.moveTo(target)
+
+	site := make([][2]matrix.Matrix, len(k))
+	weight := make([]float64, len(k))
+	total := 0.0
+	for i := range k {
+		a := s.site[target]
+		site[i] = [2]matrix.Matrix{
+			a[0].Mul(k[i][0][0]).Add(a[1].Mul(k[i][0][1])),
+			a[0].Mul(k[i][1][0]).Add(a[1].Mul(k[i][1][1])),
+		}
+		weight[i] = norm(site[i][0]) + norm(site[i][1])
+		total = total + weight[i]
+	}
+
+	r := s.float64() * total
+	for i := range k {
+		if r < weight[i] || i == len(k)-1 {
+			n := complex(1/math.Sqrt(weight[i]), 0)
+			s.site[target] = [2]matrix.Matrix{site[i][0].Mul(n), site[i][1].Mul(n)}
+			return
+		}
+		r = r - weight[i]
+	}
+}
+
+func (s *mps) Swap(b0, b1 int) {
+	if b0 != b1 {
+		s.applyOn(gate.Swap(2, 0, 1), []int{b0, b1})
+	}
+}
+
+func (s *mps) Measure(bit int) bool {
+	s.moveTo(bit)
+
+	a := s.site[bit]
+	p0, p1 := norm(a[0]), norm(a[1])
+
+	one := s.float64()*(p0+p1) >= p0
+	l, r := a[0].Dimension()
+	if one {
+		s.site[bit] = [2]matrix.Matrix{zeros(l, r), a[1].Mul(complex(1/math.Sqrt(p1), 0))}
+		return true
+	}
+
+	s.site[bit] = [2]matrix.Matrix{a[0].Mul(complex(1/math.Sqrt(p0), 0)), zeros(l, r)}
+	return false
+}
+
+func (s *mps) Probability() []float64 {
+	return s.vector().Probability()
+}
+
+func (s *mps) DensityMatrix() *density.Matrix {
+	return density.Pure(s.vector())
+}
+
+func (s *mps) Clone() Backend {
+	c := *s
+	c.site = make([][2]matrix.Matrix, len(s.site))
+	for i := range s.site {
+		c.site[i] = [2]matrix.Matrix{s.site[i][0].Clone(), s.site[i][1].Clone()}
+	}
+
+	return &c
+}
+
+// release removes the site if the qbit is not entangled, that is if its
+// reduced density matrix is pure, and multiplies what is left of it
+// into the neighboring site.
+func (s *mps) Release(bit int) error {
+	s.moveTo(bit)
+	a := s.site[bit]
+
+	// rho[x][y] = Tr(A[x] A[y]^dagger)
+	var rho [2][2]complex128
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			for i := range a[x] {
+				for j := range a[x][i] {
+					rho[x][y] = rho[x][y] + a[x][i][j]*cmplx.Conj(a[y][i][j])
+				}
+			}
+		}
+	}
+
+	purity := 0.0
+	for x := 0; x < 2; x++ {
+		for y := 0; y < 2; y++ {
+			purity = purity + real(rho[x][y]*cmplx.Conj(rho[x][y]))
+		}
+	}
+
+	if purity < 1-1e-10 {
+		return qubit.ErrEntangled
+	}
+
+	// rho = |phi><phi| and A[x] = phi[x] B
+	j := 0
+	if real(rho[1][1]) > real(rho[0][0]) {
+		j = 1
+	}
+	phi := []complex128{rho[0][j], rho[1][j]}
+	n := complex(math.Sqrt(real(rho[j][j])), 0)
+	b := a[0].Mul(cmplx.Conj(phi[0] / n)).Add(a[1].Mul(cmplx.Conj(phi[1] / n)))
+
+	switch {
+	case len(s.site) == 1:
+		s.center = 0
+	case bit > 0:
+		s.site[bit-1] = [2]matrix.Matrix{mul(s.site[bit-1][0], b), mul(s.site[bit-1][1], b)}
+		s.center = bit - 1
+	default:
+		s.site[1] = [2]matrix.Matrix{mul(b, s.site[1][0]), mul(b, s.site[1][1])}
+		s.center = 0
+	}
+
+	s.site = append(s.site[:bit], s.site[bit+1:]...)
+	return nil
+}
+
+// expectation applies the matrices to a clone without truncation
+// and returns its overlap with the state.
+func (s *mps) Expectation(u []matrix.Matrix, target [][]int) complex128 {
+	c := s.Clone().(*mps)
+	c.maxBond, c.threshold = 0, 0
+
+	for i := range u {
+		if len(target[i]) == 1 {
+			c.local(u[i], target[i][0])
+			continue
+		}
+		c.applyOn(u[i], target[i])
+	}
+
+	// the transfer matrices of <s|c> from the left
+	e := matrix.New([]complex128{1})
+	for p := range s.site {
+		e = mul(mul(s.site[p][0].Dagger(), e), c.site[p][0]).
+			Add(mul(mul(s.site[p][1].Dagger(), e), c.site[p][1]))
+	}
+
+	return e[0][0]
+}
+
+func (s *mps) Rand(src rand.Source) {
+	s.src, s.rnd = src, nil
+	if src != nil {
+		s.rnd = rand.New(src)
+	}
+}
+
+// sample draws each bit of each shot from its probability given the bits
+// before it, which the right-orthonormal sites make local.
+func (s *mps) sample(shots int) [][]bool {
+	if len(s.site) == 0 {
+		return make([][]bool, shots)
+	}
+	s.moveTo(0)
+
+	out := make([][]bool, 0, shots)
+	for i := 0; i < shots; i++ {
+		shot := make([]bool, len(s.site))
+		v := matrix.New([]complex128{1})
+		for p := range s.site {
+			v0, v1 := mul(v, s.site[p][0]), mul(v, s.site[p][1])
+			p0, p1 := norm(v0), norm(v1)
+
+			v = v0
+			if s.float64()*(p0+p1) >= p0 {
+				shot[p], v = true, v1
+			}
+		}
+
+		out = append(out, shot)
+	}
+
+	return out
+}
+
+// vector returns the state vector contracted site by site.
+func (s *mps) vector() *qubit.Qubit {
+	prefix := []matrix.Matrix{matrix.New([]complex128{1})}
+	for p := range s.site {
+		next := make([]matrix.Matrix, 0, 2*len(prefix))
+		for _, v := range prefix {
+			next = append(next, mul(v, s.site[p][0]), mul(v, s.site[p][1]))
+		}
+		prefix = next
+	}
+
+	z := make([]complex128, len(prefix))
+	for i := range prefix {
+		z[i] = prefix[i][0][0]
+	}
+
+	return qubit.New(z...).Rand(s.src)
+}
@@ -0,0 +1,106 @@
+package noise
+
+import (
+	"errors"
+	"math"
+
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+)
+
+// ErrNotComplete is returned when the sum of K^dagger K is not the identity.
+var ErrNotComplete = errors.New("noise: Kraus operators are not complete")
+
+// Eps is the tolerance of the completeness check.
+const Eps = 1e-10
+
+// Channel is a quantum channel given by its Kraus operators.
+// rho becomes sum K rho K^dagger.
+type Channel []matrix.Matrix
+
+// New creates a channel made of the Kraus operators
+// after checking their completeness.
+func New(k ...matrix.Matrix) (Channel, error) {
+	c := Channel(k)
+	if len(c) < 1 || !c.IsComplete(Eps) {
+		return nil, ErrNotComplete
+	}
+
+	return c, nil
+}
+
+// IsComplete returns true if the sum of K^dagger K is equal to the identity.
+func (c Channel) IsComplete(eps ...float64) bool {
+	sum := c[0].Apply(c[0].Dagger())
+	for i := 1; i < len(c); i++ {
+		sum = sum.Add(c[i].Apply(c[i].Dagger()))
+	}
+
+	m, _ := sum.Dimension()
+	bit := int(math.Log2(float64(m)))
+	return sum.Equals(gate.I(bit), eps...)
+}
+
+// BitFlip flips the qubit with the probability p.
+func BitFlip(p float64) Channel {
+	return Channel{
+		gate.I().Mul(complex(math.Sqrt(1-p), 0)),
+		gate.X().Mul(complex(math.Sqrt(p), 0)),
+	}
+}
+
+// PhaseFlip flips the phase of the qubit with the probability p.
+func PhaseFlip(p float64) Channel {
+	return Channel{
+		gate.I().Mul(complex(math.Sqrt(1-p), 0)),
+		gate.Z().Mul(complex(math.Sqrt(p), 0)),
+	}
+}
+
+// BitPhaseFlip applies Y to the qubit with the probability p.
+func BitPhaseFlip(p float64) Channel {
+	return Channel{
+		gate.I().Mul(complex(math.Sqrt(1-p), 0)),
+		gate.Y().Mul(complex(math.Sqrt(p), 0)),
+	}
+}
+
+// Depolarizing replaces the qubit with the completely mixed state I/2
+// with the probability p.
+func Depolarizing(p float64) Channel {
+	return Channel{
+		gate.I().Mul(complex(math.Sqrt(1-3*p/4), 0)),
+		gate.X().Mul(complex(math.Sqrt(p/4), 0)),
+		gate.Y().Mul(complex(math.Sqrt(p/4), 0)),
+		gate.Z().Mul(complex(math.Sqrt(p/4), 0)),
+	}
+}
+
+// AmplitudeDamping decays |1> to |0> with the probability gamma.
+func AmplitudeDamping(gamma float64) Channel {
+	return Channel{
+		gate.New(
+			[]complex128{1, 0},
+			[]complex128{0, complex(math.Sqrt(1-gamma), 0)},
+		),
+		gate.New(
+			[]complex128{0, complex(math.Sqrt(gamma), 0)},
+			[]complex128{0, 0},
+		),
+	}
+}
+
+// PhaseDamping loses the phase information without loss of energy.
+// The off-diagonal elements are multiplied by sqrt(1-lambda).
+func PhaseDamping(lambda float64) Channel {
+	return Channel{
+		gate.New(
+			[]complex128{1, 0},
+			[]complex128{0, complex(math.Sqrt(1-lambda), 0)},
+		),
+		gate.New(
+			[]complex128{0, 0},
+			[]complex128{0, complex(math.Sqrt(lambda), 0)},
+		),
+	}
+}
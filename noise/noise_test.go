@@ -0,0 +1,101 @@
+package noise_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/axamon/q/density"
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/noise"
+)
+
+func TestIsComplete(t *testing.T) {
+	var test = []noise.Channel{
+		noise.BitFlip(0.1),
+		noise.PhaseFlip(0.2),
+		noise.BitPhaseFlip(0.3),
+		noise.Depolarizing(0.4),
+		noise.AmplitudeDamping(0.5),
+		noise.PhaseDamping(0.6),
+	}
+
+	for _, c := range test {
+		if !c.IsComplete(1e-13) {
+			t.Error(c)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := noise.New(gate.H(), gate.X()); err != noise.ErrNotComplete {
+		t.Error(err)
+	}
+
+	if _, err := noise.New(); err != noise.ErrNotComplete {
+		t.Error(err)
+	}
+
+	c, err := noise.New(noise.AmplitudeDamping(0.3)...)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(c) != 2 {
+		t.Error(c)
+	}
+}
+
+func TestChannel(t *testing.T) {
+	var test = []struct {
+		c        noise.Channel
+		in       *density.Matrix
+		expected matrix.Matrix
+	}{
+		{
+			noise.BitFlip(0.1),
+			density.Zero(),
+			gate.New([]complex128{0.9, 0}, []complex128{0, 0.1}),
+		},
+		{
+			noise.AmplitudeDamping(0.3),
+			density.One(),
+			gate.New([]complex128{0.3, 0}, []complex128{0, 0.7}),
+		},
+		{
+			noise.PhaseDamping(0.75),
+			density.New(1, 1),
+			gate.New([]complex128{0.5, 0.25}, []complex128{0.25, 0.5}),
+		},
+		{
+			noise.PhaseFlip(0.5),
+			density.New(1, 1),
+			gate.I().Mul(0.5),
+		},
+		{
+			noise.Depolarizing(1),
+			density.New(1, 2),
+			gate.I().Mul(0.5),
+		},
+	}
+
+	for _, tt := range test {
+		actual := tt.in.ApplyKraus(tt.c, 0).Matrix()
+		if !actual.Equals(tt.expected, 1e-13) {
+			t.Errorf("%v: %v\n", actual, tt.expected)
+		}
+	}
+}
+
+func TestDepolarizing(t *testing.T) {
+	d := density.New(1, 2).ApplyKraus(noise.Depolarizing(0.2), 0)
+	expected := density.New(1, 2).Mul(0.8).Add(density.Zero().Mul(0.1)).Add(density.One().Mul(0.1))
+
+	if !d.Equals(expected, 1e-13) {
+		t.Errorf("%v: %v\n", d.Matrix(), expected.Matrix())
+	}
+
+	if math.Abs(d.Trace()-1) > 1e-13 {
+		t.Error(d.Trace())
+	}
+}
@@ -0,0 +1,131 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/axamon/q/noise"
+)
+
+// ErrNotPhysical is returned when a noise model describes a channel
+// that is not completely positive, e.g. a T2 greater than 2*T1.
+var ErrNotPhysical = errors.New("q: noise model is not physical")
+
+// NoiseModel describes the error budget of a device.
+// Every gate and measurement of a simulator created with WithNoise
+// is followed by the corresponding errors.
+type NoiseModel struct {
+	// Gate is the depolarizing probability by gate name such as "h", "x" or "swap".
+	// Controlled gates are named with the prefix "c" ("cx", "cz", "cr").
+	// The error is applied to every qbit the gate acts on.
+	Gate map[string]float64
+
+	// GateTime is the duration of the gate by name
+	// during which the qbits relax according to T1 and T2.
+	GateTime map[string]float64
+
+	// T1 is the relaxation time of the qbit by index.
+	T1 map[int]float64
+
+	// T2 is the dephasing time of the qbit by index. It must not exceed 2*T1,
+	// otherwise New fails with ErrNotPhysical.
+	T2 map[int]float64
+
+	// Readout is the measurement error of the qbit by index.
+	Readout map[int]Readout
+}
+
+// Readout is the probability that the measurement result is flipped.
+type Readout struct {
+	// P01 is the probability to read 1 when the qbit is |0>.
+	P01 float64
+
+	// P10 is the probability to read 0 when the qbit is |1>.
+	P10 float64
+}
+
+// WithNoise attaches the noise model to the simulator.
+func WithNoise(m *NoiseModel) Option {
+	return func(q *Q) {
+		q.noise = m
+	}
+}
+
+// validate returns an error if the dephasing time of a qbit exceeds
+// twice its relaxation time, where the pure dephasing rate is negative.
+func (m *NoiseModel) validate() error {
+	bit := []int{}
+	for b := range m.T2 {
+		bit = append(bit, b)
+	}
+	sort.Ints(bit)
+
+	for _, b := range bit {
+		t1, t2 := m.T1[b], m.T2[b]
+		if t1 > 0 && t2 > 2*t1 {
+			return fmt.Errorf("%w: T2 %v of qbit %d exceeds 2*T1 %v", ErrNotPhysical, t2, b, 2*t1)
+		}
+	}
+
+	return nil
+}
+
+// applyNoise applies the errors of the gate to the bits,
+// given by their positions in the state.
+func (q *Q) applyNoise(name string, bit ...int) {
+	if q.noise == nil {
+		return
+	}
+
+	if p, ok := q.noise.Gate[name]; ok && p > 0 {
+		for _, b := range bit {
+			q.state.ApplyKraus(noise.Depolarizing(p), b)
+		}
+	}
+
+	t, ok := q.noise.GateTime[name]
+	if !ok || t <= 0 {
+		return
+	}
+
+	for _, b := range bit {
+		t1, t2 := q.noise.T1[q.wire[b]], q.noise.T2[q.wire[b]]
+		if t1 > 0 {
+			q.state.ApplyKraus(noise.AmplitudeDamping(1-math.Exp(-t/t1)), b)
+		}
+
+		if t2 <= 0 {
+			continue
+		}
+
+		// pure dephasing rate 1/Tphi = 1/T2 - 1/(2*T1)
+		rate := 1 / t2
+		if t1 > 0 {
+			rate = rate - 1/(2*t1)
+		}
+
+		if rate > 0 {
+			q.state.ApplyKraus(noise.PhaseDamping(1-math.Exp(-2*t*rate)), b)
+		}
+	}
+}
+
+// misread returns true if the readout error of the bit flips the result.
+func (q *Q) misread(bit int, one bool) bool {
+	if q.noise == nil {
+		return false
+	}
+
+	r, ok := q.noise.Readout[bit]
+	if !ok {
+		return false
+	}
+
+	if one {
+		return q.float64() < r.P10
+	}
+
+	return q.float64() < r.P01
+}
@@ -0,0 +1,119 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ErrUnboundParameter is returned when a symbolic parameter has no value.
+var ErrUnboundParameter = errors.New("q: unbound parameter")
+
+// Param is a symbolic parameter of a gate. Its value is
+// Scale times the value bound to Name when the gate is executed.
+type Param struct {
+	Name  string
+	Scale float64
+}
+
+// Symbol returns the parameter of the name.
+func Symbol(name string) Param {
+	return Param{Name: name, Scale: 1}
+}
+
+// Mul returns the parameter multiplied by c.
+func (p Param) Mul(c float64) Param {
+	return Param{Name: p.Name, Scale: p.Scale * c}
+}
+
+// String returns the parameter such as "theta" or "-0.5*theta".
+func (p Param) String() string {
+	switch p.Scale {
+	case 1:
+		return p.Name
+	case -1:
+		return "-" + p.Name
+	}
+
+	return strconv.FormatFloat(p.Scale, 'g', -1, 64) + "*" + p.Name
+}
+
+// Bind returns the instruction with the values of its symbolic parameters.
+func (in Instruction) Bind(values map[string]float64) (Instruction, error) {
+	if len(in.Symbols) == 0 {
+		return in, nil
+	}
+
+	n := len(in.Params)
+	if len(in.Symbols) > n {
+		n = len(in.Symbols)
+	}
+
+	b := in
+	b.Params = make([]float64, n)
+	copy(b.Params, in.Params)
+	b.Symbols = nil
+
+	for i, s := range in.Symbols {
+		if s.Name == "" {
+			continue
+		}
+
+		v, ok := values[s.Name]
+		if !ok {
+			return Instruction{}, fmt.Errorf("%w: %v", ErrUnboundParameter, s.Name)
+		}
+		b.Params[i] = s.Scale * v
+	}
+
+	return b, nil
+}
+
+// Parameters returns the names of the symbolic parameters of the circuit.
+func (c *Circuit) Parameters() []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, in := range c.Instructions {
+		for _, s := range in.Symbols {
+			if s.Name != "" && !seen[s.Name] {
+				seen[s.Name] = true
+				names = append(names, s.Name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Bind returns the circuit with the values of its symbolic parameters.
+// Every parameter of the circuit must have a value.
+func (c *Circuit) Bind(values map[string]float64) (*Circuit, error) {
+	b := c.Clone()
+	for i, in := range b.Instructions {
+		bound, err := in.Bind(values)
+		if err != nil {
+			return nil, err
+		}
+		b.Instructions[i] = bound
+	}
+
+	return b, nil
+}
+
+// Bind sets the values of the symbolic parameters of the instructions
+// the simulator executes, such as those of RXParam. The circuit of the
+// simulator keeps the parameters symbolic, so that it can be bound to other
+// values with Circuit.Bind and run again.
+func (q *Q) Bind(values map[string]float64) *Q {
+	if q.values == nil {
+		q.values = map[string]float64{}
+	}
+
+	for k, v := range values {
+		q.values[k] = v
+	}
+
+	return q
+}
@@ -0,0 +1,267 @@
+package pauli
+
+import (
+	"fmt"
+	"math/cmplx"
+	"strings"
+
+	"github.com/axamon/q/matrix"
+)
+
+// product returns the phase and the operator of the product ab
+// of two single-qubit operators, e.g. i and Z for XY.
+func product(a, b byte) (complex128, byte) {
+	switch {
+	case a == 'I':
+		return 1, b
+	case b == 'I':
+		return 1, a
+	case a == b:
+		return 1, 'I'
+	}
+
+	// XY = iZ, YZ = iX, ZX = iY and -i in the other order
+	i, j := strings.IndexByte("XYZ", a), strings.IndexByte("XYZ", b)
+	phase := complex(0, -1)
+	if (j-i+3)%3 == 1 {
+		phase = complex(0, 1)
+	}
+
+	return phase, "XYZ"[3-i-j]
+}
+
+// trim removes the trailing identities, so that "ZI" and "Z" are the same.
+func trim(ops string) string {
+	return strings.TrimRight(ops, "I")
+}
+
+// length returns the number of operators of the longer Ops.
+func length(p0, p1 String) int {
+	if len(p0.Ops) > len(p1.Ops) {
+		return len(p0.Ops)
+	}
+
+	return len(p1.Ops)
+}
+
+// Mul returns the product p0 p1 with the phase of the operators
+// in its coefficient, e.g. iZ0 for X0 Y0.
+func (p0 String) Mul(p1 String) String {
+	coef := p0.Coef * p1.Coef
+	ops := make([]byte, length(p0, p1))
+	for i := range ops {
+		phase, op := product(p0.Op(i), p1.Op(i))
+		coef = coef * phase
+		ops[i] = op
+	}
+
+	return String{Coef: coef, Ops: trim(string(ops))}
+}
+
+// Commutes returns true if p0 p1 = p1 p0, that is if the operators
+// differ on an even number of qubits where neither is I.
+// Otherwise they anticommute.
+func (p0 String) Commutes(p1 String) bool {
+	odd := false
+	for i := 0; i < length(p0, p1); i++ {
+		a, b := p0.Op(i), p1.Op(i)
+		if a != 'I' && b != 'I' && a != b {
+			odd = !odd
+		}
+	}
+
+	return !odd
+}
+
+// QubitWiseCommutes returns true if the operators commute on each qubit,
+// so that both can be measured in the same basis.
+func (p0 String) QubitWiseCommutes(p1 String) bool {
+	for i := 0; i < length(p0, p1); i++ {
+		a, b := p0.Op(i), p1.Op(i)
+		if a != 'I' && b != 'I' && a != b {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Matrix returns the 2^n x 2^n matrix of the Pauli string on n qubits,
+// qubit 0 being the most significant bit. n is at least the length of Ops.
+func (p String) Matrix(n int) matrix.Matrix {
+	if n < len(p.Ops) {
+		n = len(p.Ops)
+	}
+
+	if n == 0 {
+		return matrix.New([]complex128{p.Coef})
+	}
+
+	m := []matrix.Matrix{}
+	for i := 0; i < n; i++ {
+		m = append(m, Matrix(p.Op(i)))
+	}
+
+	return matrix.TensorProduct(m...).Mul(p.Coef)
+}
+
+// Qubits returns the number of qubits of the longest Pauli string.
+func (s Sum) Qubits() int {
+	n := 0
+	for _, p := range s {
+		if len(p.Ops) > n {
+			n = len(p.Ops)
+		}
+	}
+
+	return n
+}
+
+// Matrix returns the 2^n x 2^n matrix of the sum on n qubits.
+// n is at least the number of qubits of the sum.
+func (s Sum) Matrix(n int) matrix.Matrix {
+	if n < s.Qubits() {
+		n = s.Qubits()
+	}
+
+	m := String{}.Matrix(n)
+	for _, p := range s {
+		m = m.Add(p.Matrix(n))
+	}
+
+	return m
+}
+
+// Mul returns the simplified product s0 s1.
+func (s0 Sum) Mul(s1 Sum) Sum {
+	out := Sum{}
+	for _, p0 := range s0 {
+		for _, p1 := range s1 {
+			out = append(out, p0.Mul(p1))
+		}
+	}
+
+	return out.Simplify()
+}
+
+// Commutes returns true if the commutator s0 s1 - s1 s0 is zero,
+// its coefficients within eps.
+func (s0 Sum) Commutes(s1 Sum, eps ...float64) bool {
+	c := s0.Mul(s1)
+	for _, p := range s1.Mul(s0) {
+		c = append(c, String{Coef: -p.Coef, Ops: p.Ops})
+	}
+
+	return len(c.Simplify(eps...)) == 0
+}
+
+// Simplify returns the sum with the Pauli strings of the same operators
+// added together, in the order they first appear. Terms whose
+// coefficient is within eps of zero are removed.
+func (s Sum) Simplify(eps ...float64) Sum {
+	index := map[string]int{}
+	sum := Sum{}
+	for _, p := range s {
+		ops := trim(p.Ops)
+		if i, ok := index[ops]; ok {
+			sum[i].Coef = sum[i].Coef + p.Coef
+			continue
+		}
+
+		index[ops] = len(sum)
+		sum = append(sum, String{Coef: p.Coef, Ops: ops})
+	}
+
+	e := matrix.Eps(eps...)
+	out := Sum{}
+	for _, p := range sum {
+		if cmplx.Abs(p.Coef) > e {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
+
+// Group returns the Pauli strings in groups whose strings commute
+// qubit-wise, so that each group is measured with one basis rotation.
+// Each string goes to the first group it commutes with.
+func (s Sum) Group() []Sum {
+	group := []Sum{}
+	for _, p := range s {
+		found := false
+		for i := range group {
+			if commutes(group[i], p) {
+				group[i] = append(group[i], p)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			group = append(group, Sum{p})
+		}
+	}
+
+	return group
+}
+
+// commutes returns true if the Pauli string commutes qubit-wise
+// with each string of the group.
+func commutes(group Sum, p String) bool {
+	for _, g := range group {
+		if !g.QubitWiseCommutes(p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Decompose returns the matrix as a sum of Pauli strings on n qubits,
+// the coefficient of P being Tr(P m)/2^n. Pauli strings whose coefficient
+// is within eps of zero are left out. The matrix must be 2^n x 2^n.
+func Decompose(m matrix.Matrix, eps ...float64) (Sum, error) {
+	r, c := m.Dimension()
+	n := 0
+	for 1<<uint(n) < r {
+		n++
+	}
+
+	if r == 0 || r != c || 1<<uint(n) != r {
+		return nil, fmt.Errorf("%w: %dx%d is not 2^n x 2^n", matrix.ErrDimensionMismatch, r, c)
+	}
+
+	e := matrix.Eps(eps...)
+	sum := Sum{}
+	ops := make([]byte, n)
+	for k := 0; k < 1<<uint(2*n); k++ {
+		// the k-th string of IXYZ in order, qubit 0 first
+		flip := 0
+		for i := 0; i < n; i++ {
+			ops[i] = "IXYZ"[k>>uint(2*(n-1-i))&3]
+			if ops[i] == 'X' || ops[i] == 'Y' {
+				flip = flip | 1<<uint(n-1-i)
+			}
+		}
+
+		// P has one element in each column j, in the row j^flip
+		tr := complex(0, 0)
+		for j := 0; j < r; j++ {
+			i := j ^ flip
+			v := m[j][i]
+			for b := 0; b < n; b++ {
+				s := uint(n - 1 - b)
+				v = v * Matrix(ops[b])[i>>s&1][j>>s&1]
+			}
+			tr = tr + v
+		}
+
+		coef := tr / complex(float64(r), 0)
+		if cmplx.Abs(coef) > e {
+			sum = append(sum, String{Coef: coef, Ops: trim(string(ops))})
+		}
+	}
+
+	return sum, nil
+}
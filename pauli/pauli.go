@@ -0,0 +1,262 @@
+// Package pauli provides Pauli strings and their weighted sums,
+// the observables of expectation values, and their algebra.
+package pauli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+)
+
+// ErrSyntax is returned when a sum of Pauli strings cannot be parsed.
+var ErrSyntax = errors.New("pauli: invalid syntax")
+
+// String is a product of Pauli operators with a coefficient, e.g. 0.5*Z0Z1.
+type String struct {
+	// Coef is the coefficient of the product.
+	Coef complex128
+
+	// Ops is the operator I, X, Y or Z of each qubit, e.g. "ZZ" for Z0Z1
+	// and "IIX" for X2.
+	Ops string
+}
+
+// Sum is a weighted sum of Pauli strings, e.g. 0.5*Z0Z1 - 1.2*X2.
+type Sum []String
+
+// New returns the Pauli string of the operators, e.g. New(0.5, "ZZ").
+func New(coef complex128, ops string) String {
+	return String{Coef: coef, Ops: ops}
+}
+
+// Op returns the operator of the qubit, I for the qubits after Ops.
+func (p String) Op(qubit int) byte {
+	if qubit < len(p.Ops) {
+		return p.Ops[qubit]
+	}
+
+	return 'I'
+}
+
+// Qubits returns the qubits of the operators other than I in order.
+func (p String) Qubits() []int {
+	q := []int{}
+	for i := range p.Ops {
+		if p.Ops[i] != 'I' {
+			q = append(q, i)
+		}
+	}
+
+	return q
+}
+
+// String returns the Pauli string such as 0.5*Z0Z1, or the coefficient
+// alone if every operator is I.
+func (p String) String() string {
+	var b strings.Builder
+	for _, q := range p.Qubits() {
+		fmt.Fprintf(&b, "%c%d", p.Ops[q], q)
+	}
+
+	if b.Len() == 0 {
+		return coef(p.Coef)
+	}
+
+	switch p.Coef {
+	case 1:
+		return b.String()
+	case -1:
+		return "-" + b.String()
+	}
+
+	return coef(p.Coef) + "*" + b.String()
+}
+
+// coef returns the coefficient as a real number if it has no imaginary part.
+func coef(z complex128) string {
+	if imag(z) == 0 {
+		return strconv.FormatFloat(real(z), 'g', -1, 64)
+	}
+
+	return strconv.FormatComplex(z, 'g', -1, 128)
+}
+
+// String returns the sum such as 0.5*Z0Z1 - 1.2*X2.
+func (s Sum) String() string {
+	var b strings.Builder
+	for i, p := range s {
+		t := p.String()
+		switch {
+		case i == 0:
+			b.WriteString(t)
+		case strings.HasPrefix(t, "-"):
+			b.WriteString(" - " + t[1:])
+		default:
+			b.WriteString(" + " + t)
+		}
+	}
+
+	if b.Len() == 0 {
+		return "0"
+	}
+
+	return b.String()
+}
+
+// IsHermite returns true if the coefficients are real.
+func (s Sum) IsHermite() bool {
+	for _, p := range s {
+		if imag(p.Coef) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Matrix returns the 2x2 matrix of the operator I, X, Y or Z.
+func Matrix(op byte) matrix.Matrix {
+	switch op {
+	case 'X':
+		return gate.X()
+	case 'Y':
+		return gate.Y()
+	case 'Z':
+		return gate.Z()
+	}
+
+	return gate.I()
+}
+
+// Parse parses a weighted sum of Pauli strings such as "0.5*Z0Z1 - 1.2*X2".
+// A term is an optional real coefficient followed by operators X, Y, Z or I
+// with the index of their qubit, optionally separated by * or spaces.
+// A coefficient alone is a multiple of the identity.
+func Parse(src string) (Sum, error) {
+	p := &parser{src: src}
+
+	sum := Sum{}
+	p.space()
+	for i := 0; p.pos < len(p.src) || i == 0; i++ {
+		sign := 1.0
+		switch {
+		case p.next("+"):
+		case p.next("-"):
+			sign = -1
+		case i > 0:
+			return nil, p.errorf("expected + or -")
+		}
+
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+
+		t.Coef = t.Coef * complex(sign, 0)
+		sum = append(sum, t)
+	}
+
+	return sum, nil
+}
+
+// MustParse is Parse that panics if the sum cannot be parsed.
+func MustParse(src string) Sum {
+	s, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %q at %d: %s", ErrSyntax, p.src, p.pos, fmt.Sprintf(format, a...))
+}
+
+func (p *parser) space() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// next skips the token if it comes next.
+func (p *parser) next(tok string) bool {
+	if !strings.HasPrefix(p.src[p.pos:], tok) {
+		return false
+	}
+
+	p.pos = p.pos + len(tok)
+	p.space()
+	return true
+}
+
+// term parses [coefficient [*]] {operator index [*]}.
+func (p *parser) term() (String, error) {
+	t := String{Coef: 1}
+
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte("0123456789.eE", p.src[p.pos]) > -1 {
+		// the sign of an exponent
+		if e := p.src[p.pos]; (e == 'e' || e == 'E') && p.pos+1 < len(p.src) && strings.IndexByte("+-", p.src[p.pos+1]) > -1 {
+			p.pos++
+		}
+		p.pos++
+	}
+
+	ops := false
+	if p.pos > start {
+		c, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			p.pos = start
+			return t, p.errorf("invalid coefficient")
+		}
+		t.Coef = complex(c, 0)
+		p.space()
+		ops = p.next("*")
+	}
+
+	for p.pos < len(p.src) && strings.IndexByte("IXYZ", p.src[p.pos]) > -1 {
+		op := p.src[p.pos]
+		p.pos++
+
+		start := p.pos
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		if p.pos == start {
+			return t, p.errorf("expected the index of the qubit of %c", op)
+		}
+
+		q, _ := strconv.Atoi(p.src[start:p.pos])
+		if q >= len(t.Ops) {
+			t.Ops = t.Ops + strings.Repeat("I", q+1-len(t.Ops))
+		}
+		if t.Ops[q] != 'I' {
+			return t, p.errorf("qubit %d repeated", q)
+		}
+		if op != 'I' {
+			t.Ops = t.Ops[:q] + string(op) + t.Ops[q+1:]
+		}
+
+		ops = false
+		p.space()
+		if p.next("*") {
+			ops = true
+		}
+	}
+
+	if ops || p.pos == start {
+		return t, p.errorf("expected an operator")
+	}
+
+	return t, nil
+}
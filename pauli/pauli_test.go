@@ -0,0 +1,211 @@
+package pauli_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/pauli"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		src  string
+		want pauli.Sum
+		str  string
+	}{
+		{"Z0", pauli.Sum{pauli.New(1, "Z")}, "Z0"},
+		{"0.5*Z0Z1 - 1.2*X2", pauli.Sum{pauli.New(0.5, "ZZ"), pauli.New(-1.2, "IIX")}, "0.5*Z0Z1 - 1.2*X2"},
+		{" -X1 * Y3 + 2 ", pauli.Sum{pauli.New(-1, "IXIY"), pauli.New(2, "")}, "-X1Y3 + 2"},
+		{"1e-3 Z0 I1", pauli.Sum{pauli.New(1e-3, "ZI")}, "0.001*Z0"},
+		{"2.5e+1*Y0", pauli.Sum{pauli.New(25, "Y")}, "25*Y0"},
+	}
+
+	for _, c := range cases {
+		s, err := pauli.Parse(c.src)
+		if err != nil {
+			t.Errorf("%q: %v", c.src, err)
+			continue
+		}
+
+		if len(s) != len(c.want) {
+			t.Errorf("%q: %v", c.src, s)
+			continue
+		}
+
+		for i := range s {
+			if s[i] != c.want[i] {
+				t.Errorf("%q: %#v", c.src, s[i])
+			}
+		}
+
+		if s.String() != c.str {
+			t.Errorf("%q: %v", c.src, s)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, src := range []string{"", "Z", "Z0 Z0", "0.5*", "Z0 +", "Z0 X1 Q2", "1.2.3*Z0"} {
+		if _, err := pauli.Parse(src); !errors.Is(err, pauli.ErrSyntax) {
+			t.Errorf("%q: %v", src, err)
+		}
+	}
+}
+
+func TestIsHermite(t *testing.T) {
+	if !pauli.MustParse("Z0 - X1").IsHermite() {
+		t.Fail()
+	}
+
+	if (pauli.Sum{pauli.New(1i, "Z")}).IsHermite() {
+		t.Fail()
+	}
+}
+
+func TestMul(t *testing.T) {
+	cases := []struct {
+		p0, p1 pauli.String
+		want   pauli.String
+	}{
+		{pauli.New(1, "X"), pauli.New(1, "Y"), pauli.New(1i, "Z")},
+		{pauli.New(1, "Y"), pauli.New(1, "X"), pauli.New(-1i, "Z")},
+		{pauli.New(1, "Z"), pauli.New(1, "X"), pauli.New(1i, "Y")},
+		{pauli.New(1, "Y"), pauli.New(1, "Z"), pauli.New(1i, "X")},
+		{pauli.New(2, "ZZ"), pauli.New(0.5, "ZZ"), pauli.New(1, "")},
+		{pauli.New(1, "XZ"), pauli.New(1, "ZX"), pauli.New(1, "YY")},
+		{pauli.New(1, "XI"), pauli.New(-1, "IIZ"), pauli.New(-1, "XIZ")},
+	}
+
+	for _, c := range cases {
+		p := c.p0.Mul(c.p1)
+		if p != c.want {
+			t.Errorf("%v %v: %v", c.p0, c.p1, p)
+		}
+
+		// Apply multiplies from the left
+		m := c.p1.Matrix(3).Apply(c.p0.Matrix(3))
+		if !m.Equals(p.Matrix(3), 1e-13) {
+			t.Errorf("%v %v: %v", c.p0, c.p1, m)
+		}
+	}
+}
+
+func TestCommutes(t *testing.T) {
+	cases := []struct {
+		p0, p1   string
+		commutes bool
+		qwc      bool
+	}{
+		{"X0", "X0", true, true},
+		{"X0", "Z0", false, false},
+		{"X0X1", "Z0Z1", true, false},
+		{"X0Z1", "X0", true, true},
+		{"X0Z1", "Z1Y2", true, true},
+		{"X0Y1Z2", "Y0Y1", false, false},
+	}
+
+	for _, c := range cases {
+		p0, p1 := pauli.MustParse(c.p0)[0], pauli.MustParse(c.p1)[0]
+		if p0.Commutes(p1) != c.commutes || p0.QubitWiseCommutes(p1) != c.qwc {
+			t.Errorf("%v %v", p0, p1)
+		}
+
+		zero := matrix.Commutator(p0.Matrix(3), p1.Matrix(3)).Equals(pauli.String{}.Matrix(3))
+		if zero != c.commutes {
+			t.Errorf("%v %v", p0, p1)
+		}
+	}
+
+	if !pauli.MustParse("X0X1 + Y0Y1").Commutes(pauli.MustParse("Z0Z1")) {
+		t.Fail()
+	}
+	if pauli.MustParse("X0 + Z1").Commutes(pauli.MustParse("Z0")) {
+		t.Fail()
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	m := pauli.MustParse("0.5*Z0Z1 - 1.2*X2").Matrix(0)
+	want := gate.Z().TensorProduct(gate.Z()).TensorProduct(gate.I()).Mul(0.5).
+		Sub(matrix.TensorProduct(gate.I(), gate.I(), gate.X()).Mul(1.2))
+
+	if !m.Equals(want, 1e-13) {
+		t.Error(m)
+	}
+
+	if m := pauli.MustParse("3").Matrix(1); !m.Equals(gate.I().Mul(3)) {
+		t.Error(m)
+	}
+}
+
+func TestDecompose(t *testing.T) {
+	cases := []struct {
+		m    matrix.Matrix
+		want string
+	}{
+		{gate.H(), "0.7071067811865476*X0 + 0.7071067811865476*Z0"},
+		{gate.CNOT(2, 0, 1), "0.5 + 0.5*X1 + 0.5*Z0 - 0.5*Z0X1"},
+		{pauli.MustParse("0.5*Z0Z1 - 1.2*X2 + 2").Matrix(0), "2 - 1.2*X2 + 0.5*Z0Z1"},
+	}
+
+	for _, c := range cases {
+		s, err := pauli.Decompose(c.m, 1e-13)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if s.String() != c.want {
+			t.Error(s)
+		}
+
+		if !s.Matrix(0).Equals(c.m, 1e-13) {
+			t.Error(s)
+		}
+	}
+
+	// a non-Hermitian matrix has complex coefficients
+	s, err := pauli.Decompose(gate.S())
+	if err != nil || s.IsHermite() || !s.Matrix(1).Equals(gate.S(), 1e-13) {
+		t.Error(s, err)
+	}
+
+	if _, err := pauli.Decompose(matrix.New([]complex128{1, 0, 0}, []complex128{0, 1, 0}, []complex128{0, 0, 1})); !errors.Is(err, matrix.ErrDimensionMismatch) {
+		t.Error(err)
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	s := pauli.MustParse("Z0 + X1 - 0.5*Z0 I1 + 1 - X1 - 0.5*Z0")
+	if got := s.Simplify(); got.String() != "1" {
+		t.Error(got)
+	}
+
+	s = pauli.MustParse("1e-15*Y0 + Z0 + Z0")
+	if got := s.Simplify(1e-13); got.String() != "2*Z0" {
+		t.Error(got)
+	}
+
+	p := pauli.MustParse("X0 + Y0").Mul(pauli.MustParse("X0 - Y0"))
+	if len(p) != 1 || math.Abs(imag(p[0].Coef)+2) > 1e-13 || p[0].Ops != "Z" {
+		t.Error(p)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	g := pauli.MustParse("Z0Z1 + X0X1 + Z0 + 2 + X1 + Y0Y1 + Z1").Group()
+
+	want := []string{"Z0Z1 + Z0 + 2 + Z1", "X0X1 + X1", "Y0Y1"}
+	if len(g) != len(want) {
+		t.Fatal(g)
+	}
+
+	for i := range g {
+		if g[i].String() != want[i] {
+			t.Error(g[i])
+		}
+	}
+}
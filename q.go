@@ -1,47 +1,315 @@
 package q
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"math/rand"
 
-	"github.com/axamon/q/gate"
+	"github.com/axamon/q/density"
 	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/noise"
 	"github.com/axamon/q/qubit"
 )
 
+var (
+	// ErrNotUnitary is returned when the matrix of a gate is not unitary.
+	ErrNotUnitary = errors.New("q: matrix is not unitary")
+
+	// ErrQubitOutOfRange is returned when a qbit is not in the register.
+	ErrQubitOutOfRange = errors.New("q: qbit out of range")
+
+	// ErrDimensionMismatch is returned when the size of a matrix or of the
+	// amplitudes does not match the number of qbits.
+	ErrDimensionMismatch = errors.New("q: dimension mismatch")
+
+	// ErrDuplicateQubit is returned when a qbit is given twice to a gate,
+	// e.g. as the control and the target.
+	ErrDuplicateQubit = errors.New("q: qbit used twice")
+
+	// ErrForeignQubit is returned when a qbit belongs to another simulator.
+	ErrForeignQubit = errors.New("q: qbit of another simulator")
+
+	// ErrNoQubit is returned when a gate is applied to no qbits.
+	ErrNoQubit = errors.New("q: no qbits")
+
+	// ErrZeroNorm is returned when the amplitudes of a new qbit are all zero.
+	ErrZeroNorm = errors.New("q: amplitudes of zero norm")
+
+	// ErrNotClifford is returned when a simulator created with WithStabilizer
+	// is given a gate, a state or a noise that is not a Clifford operation.
+	ErrNotClifford = errors.New("q: not a Clifford operation")
+)
+
 // Q type implements qubit pointer.
 type Q struct {
-	qubit *qubit.Qubit
+	state   Backend
+	noise   *NoiseModel
+	clbit   []int
+	circuit *Circuit
+
+	// values are the values of the symbolic parameters.
+	values map[string]float64
+
+	// err is the first error of the methods that do not return one.
+	err error
+
+	// rnd is the source of the measurements and of the noise,
+	// nil for the global one.
+	rnd *rand.Rand
+
+	// workers is the number of goroutines of the state vector
+	// and of the sampling, 0 for one per CPU.
+	workers int
+
+	// fuse is the number of qbits the gates are merged on, 0 for none.
+	fuse int
+
+	// pos is the position in the state of each qbit, -1 once released,
+	// and wire the index of the qbit at each position of the state.
+	pos  []int
+	wire []int
+}
+
+// Option configures the simulator created by New.
+type Option func(*Q)
+
+// WithDensityMatrix makes the simulator hold the register as a density matrix
+// so that mixed states can be represented.
+func WithDensityMatrix() Option {
+	return WithBackend(NewDensityMatrix())
+}
+
+// WithBackend makes the simulator evolve the register on the backend,
+// e.g. NewDryRun() to record the operations without simulating them.
+// The backend must have no qbits and belong to one simulator.
+func WithBackend(b Backend) Option {
+	return func(q *Q) {
+		q.state = b
+	}
+}
+
+// WithStabilizer makes the simulator hold the register as a stabilizer
+// tableau, which applies H, S, X, Y, Z, CNOT, CZ, swaps and measurements
+// to thousands of qbits in polynomial time. The qbits must be created in
+// a stabilizer state such as |0>, |1> or |+>. Other gates such as T or
+// ControlledR, and noise models with GateTime, fail with ErrNotClifford.
+// Probability, Density and Expectation expand the state vector
+// and are for small registers only.
+func WithStabilizer() Option {
+	return WithBackend(NewStabilizer())
+}
+
+// WithMPS makes the simulator hold the register as a matrix product state,
+// which needs little memory for weakly entangled registers of many qbits.
+// The bonds after a gate on several qbits are truncated to maxBond,
+// 0 for no limit, and to the singular values whose weight is at least
+// threshold. TruncationError reports the weight discarded so far.
+// Probability and Density expand the state vector and are
+// for small registers only, Sample and Measure are not.
+func WithMPS(maxBond int, threshold float64) Option {
+	return WithBackend(NewMPS(maxBond, threshold))
+}
+
+// WithRand makes the measurements and the noise of the simulator draw from
+// the source, e.g. rand.NewSource(1) to get the same results in every run.
+// The source is not safe for concurrent use by several simulators.
+func WithRand(src rand.Source) Option {
+	return func(q *Q) {
+		q.rnd = rand.New(src)
+	}
+}
+
+// WithWorkers sets the number of goroutines that apply the gates to the
+// state vector, compute its probabilities and sample it, and that multiply
+// the density matrix by the unitaries of the whole register. The loops of
+// registers of fewer than 14 qbits always run on the calling goroutine.
+// The default 0 is one per CPU and 1 disables the parallelism.
+func WithWorkers(n int) Option {
+	return func(q *Q) {
+		q.workers = n
+	}
+}
+
+// WithFusion merges the gates before they reach the state vector or the
+// density matrix: consecutive gates on the same k qbits or fewer are
+// multiplied into one unitary, so the amplitudes are updated once
+// instead of once per gate. A channel or a measurement applies the gates
+// merged on its qbits first. k = 1 merges the chains of single-qbit gates
+// on each wire. The stabilizer, MPS and dry run backends are not affected.
+func WithFusion(k int) Option {
+	return func(q *Q) {
+		q.fuse = k
+	}
 }
 
 // Qubit implements qubit reppresentation.
 type Qubit struct {
 	Index int
+
+	// owner is the simulator the qbit belongs to.
+	owner *Q
+
+	// open makes the qbit a control on |0>.
+	open bool
+}
+
+// Open returns the qbit as a control that is satisfied when it is |0>,
+// e.g. qsim.Controlled(u, []*q.Qubit{q0, q.Open(q1)}, q2).
+func Open(input *Qubit) *Qubit {
+	return &Qubit{Index: input.Index, owner: input.owner, open: true}
 }
 
-func index(input []*Qubit) []int {
+// index returns the indices of the qbits. If a qbit is nil or belongs
+// to another simulator the error is kept for Err.
+func (q *Q) index(input []*Qubit) []int {
 	index := []int{}
 	for i := range input {
-		index = append(index, input[i].Index)
+		switch {
+		case input[i] == nil:
+			q.fail(fmt.Errorf("%w: nil qbit", ErrQubitOutOfRange))
+		case input[i].owner != nil && input[i].owner != q:
+			q.fail(fmt.Errorf("%w: %d", ErrForeignQubit, input[i].Index))
+		default:
+			index = append(index, input[i].Index)
+			continue
+		}
+
+		return nil
 	}
 
 	return index
 }
 
-// New creates a new qbit.
-func New() *Q {
-	return &Q{}
+// controls returns the indices of the qbits controlling on |1>
+// and of the qbits controlling on |0>.
+func (q *Q) controls(input []*Qubit) ([]int, []int) {
+	closed, open := []int{}, []int{}
+	for i, b := range q.index(input) {
+		if input[i].open {
+			open = append(open, b)
+			continue
+		}
+		closed = append(closed, b)
+	}
+
+	return closed, open
+}
+
+// Err returns the first error of the methods that do not return one,
+// such as an ErrQubitOutOfRange of H. After an error these methods
+// do nothing.
+func (q *Q) Err() error {
+	return q.err
+}
+
+// fail keeps the error for Err if it is the first one.
+func (q *Q) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// do executes the instruction unless a method failed before
+// and keeps its error for Err. It returns true if it succeeded.
+func (q *Q) do(in Instruction) bool {
+	if q.err != nil {
+		return false
+	}
+
+	if err := q.exec(in); err != nil {
+		q.fail(err)
+		return false
+	}
+
+	return true
+}
+
+// New creates a new simulator. By default the register is a pure state vector.
+func New(opt ...Option) *Q {
+	q := &Q{state: NewStateVector(), circuit: &Circuit{}}
+	for _, o := range opt {
+		o(q)
+	}
+
+	if q.rnd != nil {
+		q.state.Rand(q.rnd)
+	}
+
+	if c, ok := q.state.(concurrent); ok {
+		c.setWorkers(q.workers)
+	}
+
+	switch q.state.(type) {
+	case Validator, sampler:
+		// they take the gates one at a time
+	default:
+		if q.fuse > 0 {
+			q.state = &fusion{state: q.state, k: q.fuse}
+		}
+	}
+
+	if n := q.state.NumberOfBit(); n > 0 {
+		q.fail(fmt.Errorf("%w: backend of %d qbits", ErrDimensionMismatch, n))
+	}
+
+	if q.noise != nil {
+		if err := q.noise.validate(); err != nil {
+			q.fail(err)
+		}
+	}
+
+	if _, ok := q.state.(*stabilizer); ok && q.noise != nil && len(q.noise.GateTime) > 0 {
+		q.fail(fmt.Errorf("%w: relaxation of the noise model", ErrNotClifford))
+	}
+
+	return q
+}
+
+// Seed makes the simulator draw from a source seeded with the seed,
+// so that the same seed gives the same measurements.
+func (q *Q) Seed(seed int64) *Q {
+	q.rnd = rand.New(rand.NewSource(seed))
+	q.state.Rand(q.rnd)
+	return q
+}
+
+// float64 returns a random number in [0.0,1.0) from the source of the simulator.
+func (q *Q) float64() float64 {
+	if q.rnd == nil {
+		return rand.Float64()
+	}
+
+	return q.rnd.Float64()
 }
 
 // New returns the pointer to the qbit.
+// It returns nil and keeps the error for Err if the amplitudes
+// are not two or are zero.
 func (q *Q) New(z ...complex128) *Qubit {
-	if q.qubit == nil {
-		q.qubit = qubit.New(z...)
-		return &Qubit{Index: 0}
+	if q.err != nil {
+		return nil
+	}
+
+	if err := qubit.Validate(z...); err != nil || len(z) != 2 {
+		if err == qubit.ErrZeroNorm {
+			q.fail(fmt.Errorf("%w: %v", ErrZeroNorm, z))
+			return nil
+		}
+		q.fail(fmt.Errorf("%w: %d amplitudes", ErrDimensionMismatch, len(z)))
+		return nil
 	}
 
-	q.qubit.TensorProduct(qubit.New(z...))
-	index := q.qubit.NumberOfBit() - 1
-	return &Qubit{Index: index}
+	if err := q.state.Add(z...); err != nil {
+		q.fail(err)
+		return nil
+	}
+	q.circuit.Init = append(q.circuit.Init, append([]complex128{}, z...))
+
+	index := len(q.pos)
+	q.pos = append(q.pos, q.state.NumberOfBit()-1)
+	q.wire = append(q.wire, index)
+	return &Qubit{Index: index, owner: q}
 }
 
 // Zero assigns 0 to the qbit.
@@ -56,109 +324,225 @@ func (q *Q) One() *Qubit {
 
 // H applies the Hadamard gate to the qbit.
 func (q *Q) H(input ...*Qubit) *Q {
-	return q.Apply(gate.H(), input...)
+	return q.apply(Instruction{Name: "h"}, input...)
 }
 
 func (q *Q) X(input ...*Qubit) *Q {
-	return q.Apply(gate.X(), input...)
+	return q.apply(Instruction{Name: "x"}, input...)
 }
 
 func (q *Q) Y(input ...*Qubit) *Q {
-	return q.Apply(gate.Y(), input...)
+	return q.apply(Instruction{Name: "y"}, input...)
 }
 
 func (q *Q) Z(input ...*Qubit) *Q {
-	return q.Apply(gate.Z(), input...)
+	return q.apply(Instruction{Name: "z"}, input...)
 }
 
 func (q *Q) S(input ...*Qubit) *Q {
-	return q.Apply(gate.S(), input...)
+	return q.apply(Instruction{Name: "s"}, input...)
 }
 
 func (q *Q) T(input ...*Qubit) *Q {
-	return q.Apply(gate.T(), input...)
+	return q.apply(Instruction{Name: "t"}, input...)
+}
+
+// RX rotates each of the qbits by theta about the x axis.
+func (q *Q) RX(theta float64, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "rx", Params: []float64{theta}}, input...)
+}
+
+// RY rotates each of the qbits by theta about the y axis.
+func (q *Q) RY(theta float64, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "ry", Params: []float64{theta}}, input...)
 }
 
+// RZ rotates each of the qbits by theta about the z axis.
+func (q *Q) RZ(theta float64, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "rz", Params: []float64{theta}}, input...)
+}
+
+// Phase shifts the phase of |1> of each of the qbits by lambda.
+func (q *Q) Phase(lambda float64, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "p", Params: []float64{lambda}}, input...)
+}
+
+// RXParam is RX of a symbolic angle. Its value must be bound by Bind.
+func (q *Q) RXParam(theta Param, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "rx", Symbols: []Param{theta}}, input...)
+}
+
+// RYParam is RY of a symbolic angle. Its value must be bound by Bind.
+func (q *Q) RYParam(theta Param, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "ry", Symbols: []Param{theta}}, input...)
+}
+
+// RZParam is RZ of a symbolic angle. Its value must be bound by Bind.
+func (q *Q) RZParam(theta Param, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "rz", Symbols: []Param{theta}}, input...)
+}
+
+// PhaseParam is Phase of a symbolic angle. Its value must be bound by Bind.
+func (q *Q) PhaseParam(lambda Param, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "p", Symbols: []Param{lambda}}, input...)
+}
+
+// U3 applies the generic single qubit gate to each of the qbits.
+func (q *Q) U3(theta, phi, lambda float64, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "u3", Params: []float64{theta, phi, lambda}}, input...)
+}
+
+// Apply applies the 2x2 matrix to each of the qbits.
 func (q *Q) Apply(mat matrix.Matrix, input ...*Qubit) *Q {
-	index := []int{}
-	for i := range input {
-		index = append(index, input[i].Index)
-	}
+	return q.apply(Instruction{Name: "unitary", Matrix: mat}, input...)
+}
 
-	g := gate.I()
-	if index[0] == 0 {
-		g = mat
+// ApplyOn applies the 2^k x 2^k matrix to the k qbits in the order given,
+// the first qbit being the most significant bit of the matrix,
+// e.g. qsim.ApplyOn(gate.Fredkin(), q5, q1, q3). The qbits need not be adjacent.
+// Err is ErrDimensionMismatch if the matrix does not match the number of qbits
+// and ErrDuplicateQubit if a qbit is given twice.
+func (q *Q) ApplyOn(mat matrix.Matrix, input ...*Qubit) *Q {
+	target := q.index(input)
+	if q.err == nil && len(mat) != 1<<uint(len(input)) {
+		q.fail(fmt.Errorf("%w: matrix of dimension %d on %d qbits", ErrDimensionMismatch, len(mat), len(input)))
 	}
 
-	for i := 1; i < q.qubit.NumberOfBit(); i++ {
-		found := false
-		for j := range index {
-			if i == index[j] {
-				found = true
-				break
-			}
-		}
+	q.do(Instruction{Name: "unitary", Matrix: mat, Target: target})
+	return q
+}
 
-		if found {
-			g = g.TensorProduct(mat)
-			continue
-		}
+// apply executes the instruction on each of the qbits.
+func (q *Q) apply(in Instruction, input ...*Qubit) *Q {
+	if len(input) == 0 {
+		q.fail(fmt.Errorf("%w: %v", ErrNoQubit, in.Name))
+	}
 
-		g = g.TensorProduct(gate.I())
+	for _, t := range q.index(input) {
+		in.Target = []int{t}
+		q.do(in)
 	}
 
-	q.qubit.Apply(g)
 	return q
 }
 
-func (q *Q) ControlledR(control []*Qubit, target *Qubit, k int) *Q {
-	bit := q.qubit.NumberOfBit()
-	cr := gate.ControlledR(bit, index(control), target.Index, k)
+// ApplyChannel applies the noise channel to each of the qbits.
+// On the density matrix the channel is applied exactly,
+// on the state vector one Kraus operator is sampled (stochastic trajectory).
+// The operators must be 2x2 and complete, else Err is noise.ErrNotComplete
+// or ErrDimensionMismatch.
+func (q *Q) ApplyChannel(c noise.Channel, input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "kraus", Kraus: c}, input...)
+}
+
+// Controlled applies the 2^k x 2^k matrix to the k target qbits
+// if the control qbits are |1>, or |0> for the controls marked with Open.
+func (q *Q) Controlled(mat matrix.Matrix, control []*Qubit, target ...*Qubit) *Q {
+	c, o := q.controls(control)
+	q.do(Instruction{
+		Name:    "unitary",
+		Matrix:  mat,
+		Target:  q.index(target),
+		Control: c,
+		Open:    o,
+	})
 
-	q.qubit.Apply(cr)
 	return q
 }
 
+func (q *Q) ControlledR(control []*Qubit, target *Qubit, k int) *Q {
+	return q.controlledParam("r", control, target, float64(k))
+}
+
 func (q *Q) CR(control *Qubit, target *Qubit, k int) *Q {
 	return q.ControlledR([]*Qubit{control}, target, k)
 }
 
-func (q *Q) ControlledZ(control []*Qubit, target *Qubit) *Q {
-	bit := q.qubit.NumberOfBit()
-	cnot := gate.ControlledZ(bit, index(control), target.Index)
+func (q *Q) ControlledRX(control []*Qubit, target *Qubit, theta float64) *Q {
+	return q.controlledParam("rx", control, target, theta)
+}
+
+func (q *Q) CRX(control *Qubit, target *Qubit, theta float64) *Q {
+	return q.ControlledRX([]*Qubit{control}, target, theta)
+}
+
+func (q *Q) ControlledRY(control []*Qubit, target *Qubit, theta float64) *Q {
+	return q.controlledParam("ry", control, target, theta)
+}
+
+func (q *Q) CRY(control *Qubit, target *Qubit, theta float64) *Q {
+	return q.ControlledRY([]*Qubit{control}, target, theta)
+}
+
+func (q *Q) ControlledRZ(control []*Qubit, target *Qubit, theta float64) *Q {
+	return q.controlledParam("rz", control, target, theta)
+}
+
+func (q *Q) CRZ(control *Qubit, target *Qubit, theta float64) *Q {
+	return q.ControlledRZ([]*Qubit{control}, target, theta)
+}
+
+func (q *Q) ControlledPhase(control []*Qubit, target *Qubit, lambda float64) *Q {
+	return q.controlledParam("p", control, target, lambda)
+}
+
+func (q *Q) CPhase(control *Qubit, target *Qubit, lambda float64) *Q {
+	return q.ControlledPhase([]*Qubit{control}, target, lambda)
+}
+
+func (q *Q) ControlledU3(control []*Qubit, target *Qubit, theta, phi, lambda float64) *Q {
+	return q.controlledParam("u3", control, target, theta, phi, lambda)
+}
+
+func (q *Q) CU3(control *Qubit, target *Qubit, theta, phi, lambda float64) *Q {
+	return q.ControlledU3([]*Qubit{control}, target, theta, phi, lambda)
+}
+
+// controlledParam executes the controlled gate of the parameters.
+func (q *Q) controlledParam(name string, control []*Qubit, target *Qubit, params ...float64) *Q {
+	c, o := q.controls(control)
+	q.do(Instruction{
+		Name:    name,
+		Params:  params,
+		Target:  q.index([]*Qubit{target}),
+		Control: c,
+		Open:    o,
+	})
 
-	q.qubit.Apply(cnot)
 	return q
 }
 
+func (q *Q) ControlledZ(control []*Qubit, target *Qubit) *Q {
+	return q.controlledParam("z", control, target)
+}
+
 func (q *Q) CZ(control *Qubit, target *Qubit) *Q {
 	return q.ControlledZ([]*Qubit{control}, target)
 }
 
 func (q *Q) ControlledNot(control []*Qubit, target *Qubit) *Q {
-	bit := q.qubit.NumberOfBit()
-	cnot := gate.ControlledNot(bit, index(control), target.Index)
-
-	q.qubit.Apply(cnot)
-	return q
+	return q.controlledParam("x", control, target)
 }
 
 func (q *Q) CNOT(control *Qubit, target *Qubit) *Q {
 	return q.ControlledNot([]*Qubit{control}, target)
 }
 
+// QFT applies the Quantum Fourier Transformation to the whole register.
 func (q *Q) QFT() *Q {
-	bit := q.qubit.NumberOfBit()
-	q.qubit.Apply(gate.QFT(bit))
+	q.do(Instruction{Name: "qft", Target: q.bits()})
 	return q
 }
 
+// InverseQFT applies the inverse Quantum Fourier Transformation to the whole register.
 func (q *Q) InverseQFT() *Q {
-	bit := q.qubit.NumberOfBit()
-	q.qubit.Apply(gate.QFT(bit).Dagger())
+	q.do(Instruction{Name: "iqft", Target: q.bits()})
 	return q
 }
 
+// ConditionX applies X if the condition is true.
+// Only the applied gate is recorded in the circuit,
+// IfRegister records the condition as well.
 func (q *Q) ConditionX(condition bool, input ...*Qubit) *Q {
 	if condition {
 		return q.X(input...)
@@ -166,6 +550,9 @@ func (q *Q) ConditionX(condition bool, input ...*Qubit) *Q {
 	return q
 }
 
+// ConditionZ applies Z if the condition is true.
+// Only the applied gate is recorded in the circuit,
+// IfRegister records the condition as well.
 func (q *Q) ConditionZ(condition bool, input ...*Qubit) *Q {
 	if condition {
 		return q.Z(input...)
@@ -174,44 +561,126 @@ func (q *Q) ConditionZ(condition bool, input ...*Qubit) *Q {
 }
 
 func (q *Q) Swap(q0, q1 *Qubit) *Q {
-	bit := q.qubit.NumberOfBit()
-	swap := gate.Swap(bit, q0.Index, q1.Index)
-	q.qubit.Apply(swap)
+	q.do(Instruction{Name: "swap", Target: q.index([]*Qubit{q0, q1})})
 	return q
 }
 
 // Measure measures the qbit level.
+// Without input every qbit is measured and the basis state is returned.
+// It returns nil if Err is not nil.
 func (q *Q) Measure(input ...*Qubit) *qubit.Qubit {
-	if len(input) < 1 {
-		return q.qubit.Measure()
+	if len(input) > 0 {
+		bit := q.index(input[:1])
+		if bit == nil {
+			return nil
+		}
+		return q.measure(bit[0])
 	}
-	return q.qubit.Measure(input[0].Index)
+
+	if len(q.bits()) == 0 {
+		q.fail(fmt.Errorf("%w: measure", ErrNoQubit))
+		return nil
+	}
+
+	m := []*qubit.Qubit{}
+	for _, b := range q.bits() {
+		r := q.measure(b)
+		if r == nil {
+			return nil
+		}
+		m = append(m, r)
+	}
+
+	return qubit.TensorProduct(m...)
+}
+
+// measure measures the bit into a new classical bit.
+func (q *Q) measure(bit int) *qubit.Qubit {
+	c := len(q.clbit)
+	if !q.do(Instruction{Name: "measure", Target: []int{bit}, Clbit: []int{c}}) {
+		return nil
+	}
+
+	if q.clbit[c] == 1 {
+		return qubit.One()
+	}
+
+	return qubit.Zero()
+}
+
+// Reset measures each of the qbits and flips it to |0> if it is |1>.
+func (q *Q) Reset(input ...*Qubit) *Q {
+	return q.apply(Instruction{Name: "reset"}, input...)
+}
+
+// Release traces the qbit out of the register, e.g. an ancilla that was
+// measured or reset, so that the state no longer grows with it.
+// On the state vector the qbit must not be entangled with the others.
+// The other qbits keep their indices and the state of Probability has
+// the remaining qbits in order. Using the qbit afterwards is ErrQubitOutOfRange.
+func (q *Q) Release(input *Qubit) *Q {
+	bit := q.index([]*Qubit{input})
+	if q.err != nil {
+		return q
+	}
+
+	if err := q.check(Instruction{Name: "release", Target: bit}); err != nil {
+		q.fail(err)
+		return q
+	}
+
+	b := bit[0]
+	p := q.pos[b]
+	if err := q.state.Release(p); err != nil {
+		q.fail(fmt.Errorf("q: release %d: %w", b, err))
+		return q
+	}
+
+	q.pos[b] = -1
+	for i := range q.pos {
+		if q.pos[i] > p {
+			q.pos[i]--
+		}
+	}
+	q.wire = append(q.wire[:p:p], q.wire[p+1:]...)
+
+	return q
+}
+
+// TruncationError returns the sum of the weights of the singular values
+// a simulator created with WithMPS discarded, 0 for the others.
+func (q *Q) TruncationError() float64 {
+	if s, ok := q.state.(*mps); ok {
+		return s.truncation
+	}
+
+	return 0
 }
 
 func (q *Q) Probability() []float64 {
-	return q.qubit.Probability()
+	return q.state.Probability()
+}
+
+// DensityMatrix returns the density matrix of the register.
+func (q *Q) DensityMatrix() *density.Matrix {
+	return q.state.DensityMatrix()
 }
 
+// Estimate estimates the amplitudes of the qbit from loop samples
+// of the register, 1000 by default. It returns nil if Err is not nil.
 func (q *Q) Estimate(input *Qubit, loop ...int) *qubit.Qubit {
 	limit := 1000
 	if len(loop) > 0 {
 		limit = loop[0]
 	}
 
-	c := []int{0, 0}
-	for i := 0; i < limit; i++ {
-		clone := q.qubit.Clone()
-		m := clone.Measure(input.Index)
-
-		if m.IsZero() {
-			c[0]++
-		} else {
-			c[1]++
-		}
+	c := q.Sample(limit, input)
+	if c == nil {
+		return nil
 	}
 
-	z := complex(math.Sqrt(float64(c[0])/float64(limit)), 0)
-	o := complex(math.Sqrt(float64(c[1])/float64(limit)), 0)
+	z := complex(math.Sqrt(float64(c["0"])/float64(limit)), 0)
+	o := complex(math.Sqrt(float64(c["1"])/float64(limit)), 0)
 
 	return qubit.New(z, o)
 }
@@ -1,15 +1,21 @@
 package q_test
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"math/rand"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/axamon/q"
+	"github.com/axamon/q/density"
 	"github.com/axamon/q/gate"
 	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/noise"
 	"github.com/axamon/q/number"
+	"github.com/axamon/q/pauli"
 	"github.com/axamon/q/qubit"
 )
 
@@ -996,3 +1002,1578 @@ func TestErrorCorrectionPhaseFlip1(t *testing.T) {
 		t.Error(p)
 	}
 }
+
+func TestQSimQFTMatrix(t *testing.T) {
+	qsim := q.New()
+
+	q0 := qsim.New(1, 2)
+	qsim.New(3, 4)
+	q2 := qsim.New(5, 6)
+	qsim.H(q0).CNOT(q0, q2)
+
+	expected := qubit.TensorProduct(qubit.New(1, 2), qubit.New(3, 4), qubit.New(5, 6))
+	expected.Apply(matrix.TensorProduct(gate.H(), gate.I(2))).Apply(gate.CNOT(3, 0, 2))
+
+	qsim.QFT()
+	expected.Apply(gate.QFT(3))
+
+	p, e := qsim.Probability(), expected.Probability()
+	for i := range p {
+		if math.Abs(p[i]-e[i]) > 1e-13 {
+			t.Errorf("%v: %v\n", p, e)
+		}
+	}
+
+	qsim.InverseQFT()
+	expected.Apply(gate.QFT(3).Dagger())
+
+	p, e = qsim.Probability(), expected.Probability()
+	for i := range p {
+		if math.Abs(p[i]-e[i]) > 1e-13 {
+			t.Errorf("%v: %v\n", p, e)
+		}
+	}
+}
+
+func TestQSim20qubit(t *testing.T) {
+	qsim := q.New()
+
+	input := []*q.Qubit{}
+	for i := 0; i < 20; i++ {
+		input = append(input, qsim.Zero())
+	}
+
+	qsim.H(input[0])
+	for i := 1; i < len(input); i++ {
+		qsim.CNOT(input[0], input[i])
+	}
+
+	// GHZ state
+	p := qsim.Probability()
+	if math.Abs(p[0]-0.5) > 1e-13 || math.Abs(p[len(p)-1]-0.5) > 1e-13 {
+		t.Error(p[0], p[len(p)-1])
+	}
+
+	m := qsim.Measure(input[0]).IsOne()
+	for i := 1; i < len(input); i++ {
+		if qsim.Measure(input[i]).IsOne() != m {
+			t.Error(i)
+		}
+	}
+}
+
+func TestQSimDensityMatrix(t *testing.T) {
+	for _, opt := range [][]q.Option{{}, {q.WithDensityMatrix()}} {
+		qsim := q.New(opt...)
+
+		q0 := qsim.Zero()
+		q1 := qsim.Zero()
+		q2 := qsim.Zero()
+		q3 := qsim.One()
+
+		qsim.H(q0, q1, q2, q3)
+
+		// oracle
+		qsim.X(q0).ControlledNot([]*q.Qubit{q0, q1, q2}, q3).X(q0)
+
+		// amp
+		qsim.H(q0, q1, q2, q3)
+		qsim.X(q0, q1, q2)
+		qsim.ControlledZ([]*q.Qubit{q0, q1}, q2)
+		qsim.H(q0, q1, q2)
+
+		p := qsim.Probability()
+		if math.Abs(p[7]-0.78125) > 1e-13 {
+			t.Error(p)
+		}
+
+		if math.Abs(qsim.DensityMatrix().Purity()-1) > 1e-13 {
+			t.Error(qsim.DensityMatrix().Purity())
+		}
+	}
+}
+
+func TestQSimDensityMatrixTeleportation(t *testing.T) {
+	qsim := q.New(q.WithDensityMatrix())
+
+	phi := qsim.New(1, 2)
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+
+	qsim.H(q0).CNOT(q0, q1) // bell state
+	qsim.CNOT(phi, q0).H(phi)
+
+	mz := qsim.Measure(phi)
+	mx := qsim.Measure(q0)
+
+	qsim.ConditionZ(mz.IsOne(), q1)
+	qsim.ConditionX(mx.IsOne(), q1)
+
+	rho := qsim.DensityMatrix().PartialTrace(0, 1)
+	if !rho.Matrix().Equals(density.New(1, 2).Matrix(), 1e-13) {
+		t.Error(rho.Matrix())
+	}
+}
+
+func TestQSimApplyChannel(t *testing.T) {
+	qsim := q.New(q.WithDensityMatrix())
+
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+
+	qsim.H(q0).CNOT(q0, q1)
+	qsim.ApplyChannel(noise.PhaseFlip(0.5), q0)
+
+	// (|00><00| + |11><11|)/2
+	rho := qsim.DensityMatrix()
+	if math.Abs(rho.Purity()-0.5) > 1e-13 {
+		t.Error(rho.Matrix())
+	}
+
+	p := qsim.Probability()
+	if math.Abs(p[0]-0.5) > 1e-13 || math.Abs(p[3]-0.5) > 1e-13 {
+		t.Error(p)
+	}
+}
+
+func TestQSimApplyChannelTrajectory(t *testing.T) {
+	c := 0
+	for i := 0; i < 1000; i++ {
+		qsim := q.New()
+
+		q0 := qsim.One()
+		qsim.ApplyChannel(noise.AmplitudeDamping(0.3), q0)
+
+		if qsim.Measure(q0).IsZero() {
+			c++
+		}
+	}
+
+	if math.Abs(float64(c)/1000-0.3) > 0.1 {
+		t.Error(c)
+	}
+}
+
+func TestQSimApplyChannelErr(t *testing.T) {
+	cases := []struct {
+		c   noise.Channel
+		err error
+	}{
+		{noise.Channel{}, noise.ErrNotComplete},
+		{noise.Channel{gate.X().Mul(2)}, noise.ErrNotComplete},
+		{noise.Channel{gate.CNOT(2, 0, 1)}, q.ErrDimensionMismatch},
+		{noise.Channel{matrix.Matrix{{1, 0}, {0}}}, q.ErrDimensionMismatch},
+	}
+
+	for _, c := range cases {
+		for _, opt := range []q.Option{q.WithDensityMatrix(), q.WithRand(rand.NewSource(1))} {
+			qsim := q.New(opt)
+			qsim.ApplyChannel(c.c, qsim.Zero())
+			if !errors.Is(qsim.Err(), c.err) {
+				t.Error(c.c, qsim.Err())
+			}
+		}
+	}
+}
+
+func TestQSimNoiseModel(t *testing.T) {
+	qsim := q.New(
+		q.WithDensityMatrix(),
+		q.WithNoise(&q.NoiseModel{
+			Gate: map[string]float64{"x": 0.2},
+		}),
+	)
+
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	qsim.X(q0)
+	qsim.H(q1)
+
+	// (1-p)|1><1| + p*I/2
+	p := qsim.DensityMatrix().PartialTrace(1).Probability()
+	if math.Abs(p[0]-0.1) > 1e-13 || math.Abs(p[1]-0.9) > 1e-13 {
+		t.Error(p)
+	}
+
+	// no error on H
+	if math.Abs(qsim.DensityMatrix().PartialTrace(0).Purity()-1) > 1e-13 {
+		t.Error(qsim.DensityMatrix().Matrix())
+	}
+}
+
+func TestQSimNoiseModelRelaxation(t *testing.T) {
+	t1, t2, gt := 50.0, 30.0, 10.0
+	qsim := q.New(
+		q.WithDensityMatrix(),
+		q.WithNoise(&q.NoiseModel{
+			GateTime: map[string]float64{"h": gt},
+			T1:       map[int]float64{0: t1},
+			T2:       map[int]float64{0: t2},
+		}),
+	)
+
+	q0 := qsim.Zero()
+	qsim.H(q0)
+
+	rho := qsim.DensityMatrix().Matrix()
+	if math.Abs(real(rho[1][1])-0.5*math.Exp(-gt/t1)) > 1e-13 {
+		t.Error(rho)
+	}
+
+	if math.Abs(real(rho[0][1])-0.5*math.Exp(-gt/t2)) > 1e-13 {
+		t.Error(rho)
+	}
+}
+
+func TestQSimNoiseModelNotPhysical(t *testing.T) {
+	var test = []struct {
+		t1, t2 map[int]float64
+		err    error
+	}{
+		{map[int]float64{0: 50}, map[int]float64{0: 100}, nil},
+		{map[int]float64{0: 50}, map[int]float64{0: 101}, q.ErrNotPhysical},
+		{map[int]float64{0: 50, 1: 50}, map[int]float64{0: 30, 1: 120}, q.ErrNotPhysical},
+		{map[int]float64{}, map[int]float64{0: 120}, nil},
+	}
+
+	for _, tt := range test {
+		qsim := q.New(
+			q.WithDensityMatrix(),
+			q.WithNoise(&q.NoiseModel{
+				GateTime: map[string]float64{"h": 10},
+				T1:       tt.t1,
+				T2:       tt.t2,
+			}),
+		)
+
+		if !errors.Is(qsim.Err(), tt.err) {
+			t.Errorf("%v %v: %v", tt.t1, tt.t2, qsim.Err())
+		}
+	}
+}
+
+func TestQSimNoiseModelReadout(t *testing.T) {
+	qsim := q.New(q.WithNoise(&q.NoiseModel{
+		Readout: map[int]q.Readout{0: {P01: 1}},
+	}))
+
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+
+	if !qsim.Measure(q0).IsOne() {
+		t.Error(qsim.Probability())
+	}
+
+	if !qsim.Measure(q1).IsZero() {
+		t.Error(qsim.Probability())
+	}
+
+	// the state is not flipped
+	if qsim.Probability()[0] != 1 {
+		t.Error(qsim.Probability())
+	}
+}
+
+func TestQSimNoiseModelErrorCorrection(t *testing.T) {
+	// the bit-flip code corrects any single error on the data qbits
+	qsim := q.New(
+		q.WithDensityMatrix(),
+		q.WithNoise(&q.NoiseModel{
+			Gate: map[string]float64{"x": 1},
+		}),
+	)
+
+	q0 := qsim.Zero()
+
+	// encoding
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+	qsim.CNOT(q0, q1).CNOT(q0, q2)
+
+	// error: X with the depolarizing probability 1
+	qsim.X(q0)
+
+	q3 := qsim.Zero()
+	q4 := qsim.Zero()
+	qsim.CNOT(q0, q3).CNOT(q1, q3)
+	qsim.CNOT(q1, q4).CNOT(q2, q4)
+
+	m3 := qsim.Measure(q3)
+	m4 := qsim.Measure(q4)
+
+	// p(q1q2 = 00) = 1
+	p := qsim.DensityMatrix().PartialTrace(0, 3, 4).Probability()
+	if math.Abs(p[0]-1) > 1e-13 {
+		t.Error(p)
+	}
+
+	// the syndrome never points to q1 or q2
+	if m3.IsOne() && m4.IsOne() || m3.IsZero() && m4.IsOne() {
+		t.Errorf("%v %v\n", m3, m4)
+	}
+}
+
+func TestQSimCircuit(t *testing.T) {
+	qsim := q.New()
+
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+	q3 := qsim.One()
+
+	qsim.H(q0, q1, q2, q3)
+	qsim.X(q0).ControlledNot([]*q.Qubit{q0, q1, q2}, q3).X(q0)
+	qsim.H(q0, q1, q2, q3)
+	qsim.X(q0, q1, q2)
+	qsim.ControlledZ([]*q.Qubit{q0, q1}, q2)
+	qsim.H(q0, q1, q2)
+
+	c := qsim.Circuit()
+	if c.NumberOfBit() != 4 || len(c.Instructions) != 18 {
+		t.Error(c)
+	}
+
+	if c.Instructions[5].String() != "x c[0 1 2] t[3]" {
+		t.Error(c.Instructions[5])
+	}
+
+	// replay on each backend
+	for _, opt := range [][]q.Option{{}, {q.WithDensityMatrix()}} {
+		replay := q.New(opt...)
+		if err := replay.Run(c); err != nil {
+			t.Error(err)
+		}
+
+		p, e := replay.Probability(), qsim.Probability()
+		for i := range p {
+			if math.Abs(p[i]-e[i]) > 1e-13 {
+				t.Errorf("%v: %v\n", p, e)
+			}
+		}
+	}
+}
+
+func TestQSimCircuitInverse(t *testing.T) {
+	qsim := q.New()
+
+	q0 := qsim.New(1, 2)
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+
+	qsim.H(q1).S(q1).T(q2).CR(q1, q2, 3).CNOT(q1, q2).Swap(q0, q2).QFT()
+
+	inv, err := qsim.Circuit().Inverse()
+	if err != nil {
+		t.Error(err)
+	}
+
+	inv.Init = nil
+	if err := qsim.Run(inv); err != nil {
+		t.Error(err)
+	}
+
+	p := qsim.Probability()
+	if math.Abs(p[0]-0.2) > 1e-13 || math.Abs(p[4]-0.8) > 1e-13 {
+		t.Error(p)
+	}
+
+	qsim.Measure(q0)
+	if _, err := qsim.Circuit().Inverse(); err != q.ErrNotInvertible {
+		t.Error(err)
+	}
+
+	if _, err := (q.Instruction{Name: "r", Target: []int{0}}).Inverse(); !errors.Is(err, q.ErrDimensionMismatch) {
+		t.Error(err)
+	}
+}
+
+func TestQSimCircuitCondition(t *testing.T) {
+	c := q.NewCircuit(3)
+	c.Init[0] = []complex128{1, 2}
+
+	c.Append(
+		q.Instruction{Name: "h", Target: []int{1}},
+		q.Instruction{Name: "x", Control: []int{1}, Target: []int{2}},
+		q.Instruction{Name: "x", Control: []int{0}, Target: []int{1}},
+		q.Instruction{Name: "h", Target: []int{0}},
+		q.Instruction{Name: "measure", Target: []int{0, 1}, Clbit: []int{0, 1}},
+		q.Instruction{Name: "z", Target: []int{2}, Condition: &q.Condition{Clbit: []int{0}, Value: 1}},
+		q.Instruction{Name: "x", Target: []int{2}, Condition: &q.Condition{Clbit: []int{1}, Value: 1}},
+	)
+
+	if c.Clbits != 2 {
+		t.Error(c.Clbits)
+	}
+
+	for i := 0; i < 10; i++ {
+		qsim := q.New()
+		if err := qsim.Run(c); err != nil {
+			t.Error(err)
+		}
+
+		p := qsim.Probability()
+		m := qsim.Clbits()
+		k := m[0]*4 + m[1]*2
+		if math.Abs(p[k]-0.2) > 1e-13 || math.Abs(p[k+1]-0.8) > 1e-13 {
+			t.Errorf("%v: %v\n", m, p)
+		}
+	}
+
+	qsim := q.New()
+	if err := qsim.Run(q.NewCircuit(1).Append(q.Instruction{Name: "foo", Target: []int{0}})); !errors.Is(err, q.ErrUnknownInstruction) {
+		t.Error(qsim.Circuit())
+	}
+}
+
+func TestQSimRotation(t *testing.T) {
+	theta, phi, lambda := 0.3, 1.2, -0.7
+
+	qsim := q.New()
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.One()
+
+	qsim.H(q0, q1)
+	qsim.RX(theta, q0, q1).RY(phi, q1, q2).RZ(lambda, q0).Phase(theta, q2).U3(theta, phi, lambda, q0, q2)
+	qsim.CRX(q0, q1, theta).CRY(q1, q2, phi).CRZ(q2, q0, lambda)
+	qsim.ControlledPhase([]*q.Qubit{q0, q1}, q2, theta).CU3(q2, q1, theta, phi, lambda)
+
+	expected := q.New()
+	e0 := expected.Zero()
+	e1 := expected.Zero()
+	e2 := expected.One()
+
+	expected.H(e0, e1)
+	expected.Apply(gate.RX(theta), e0, e1).Apply(gate.RY(phi), e1, e2).Apply(gate.RZ(lambda), e0)
+	expected.Apply(gate.Phase(theta), e2).Apply(gate.U3(theta, phi, lambda), e0, e2)
+	expected.Run(q.NewCircuit(3).Append(
+		q.Instruction{Name: "unitary", Matrix: gate.RX(theta), Control: []int{0}, Target: []int{1}},
+		q.Instruction{Name: "unitary", Matrix: gate.RY(phi), Control: []int{1}, Target: []int{2}},
+		q.Instruction{Name: "unitary", Matrix: gate.RZ(lambda), Control: []int{2}, Target: []int{0}},
+		q.Instruction{Name: "unitary", Matrix: gate.Phase(theta), Control: []int{0, 1}, Target: []int{2}},
+		q.Instruction{Name: "unitary", Matrix: gate.U3(theta, phi, lambda), Control: []int{2}, Target: []int{1}},
+	))
+
+	if !qsim.DensityMatrix().Equals(expected.DensityMatrix(), 1e-13) {
+		t.Errorf("%v: %v", qsim.Probability(), expected.Probability())
+	}
+
+	inv, err := qsim.Circuit().Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv.Init = nil
+	if err := qsim.Run(inv); err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(qsim.Probability()[1]-1) > 1e-13 {
+		t.Error(qsim.Probability())
+	}
+}
+
+func TestQSimParam(t *testing.T) {
+	theta, gamma := q.Symbol("theta"), q.Symbol("gamma")
+
+	c := q.NewCircuit(2).Append(
+		q.Instruction{Name: "h", Target: []int{0}},
+		q.Instruction{Name: "h", Target: []int{1}},
+		q.Instruction{Name: "rx", Symbols: []q.Param{theta}, Target: []int{0}},
+		q.Instruction{Name: "x", Control: []int{0}, Target: []int{1}},
+		q.Instruction{Name: "rz", Symbols: []q.Param{gamma.Mul(2)}, Target: []int{1}},
+		q.Instruction{Name: "u", Params: []float64{0.1, 0, 0.3, 0.4}, Symbols: []q.Param{{}, theta}, Target: []int{1}},
+	)
+
+	if p := c.Parameters(); len(p) != 2 || p[0] != "gamma" || p[1] != "theta" {
+		t.Error(p)
+	}
+
+	if err := q.New().Run(c); !errors.Is(err, q.ErrUnboundParameter) {
+		t.Error(err)
+	}
+
+	for _, v := range []float64{0.5, 1.5} {
+		qsim := q.New().Bind(map[string]float64{"theta": v, "gamma": -v})
+		if err := qsim.Run(c); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := q.New()
+		e0 := expected.Zero()
+		e1 := expected.Zero()
+		expected.H(e0, e1).RX(v, e0).CNOT(e0, e1).RZ(-2*v, e1).Apply(gate.U(0.1, v, 0.3, 0.4), e1)
+
+		if !qsim.DensityMatrix().Equals(expected.DensityMatrix(), 1e-13) {
+			t.Errorf("%v: %v", qsim.Probability(), expected.Probability())
+		}
+
+		bound, err := c.Bind(map[string]float64{"theta": v, "gamma": -v})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(bound.Parameters()) != 0 || bound.Instructions[4].Params[0] != -2*v {
+			t.Error(bound)
+		}
+
+		inv, err := c.Inverse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inv.Init = nil
+		if err := qsim.Run(inv); err != nil {
+			t.Fatal(err)
+		}
+
+		if math.Abs(qsim.Probability()[0]-1) > 1e-13 {
+			t.Error(qsim.Probability())
+		}
+	}
+
+	if _, err := c.Bind(map[string]float64{"theta": 1}); err == nil {
+		t.Error(err)
+	}
+}
+
+func TestQSimParamFluent(t *testing.T) {
+	theta := q.Symbol("theta")
+
+	qsim := q.New().Bind(map[string]float64{"theta": 0.5})
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	qsim.H(q0).RXParam(theta, q0).RYParam(theta.Mul(-1), q1).CNOT(q0, q1).RZParam(theta.Mul(2), q1).PhaseParam(theta, q0, q1)
+
+	c := qsim.Circuit()
+	if p := c.Parameters(); len(p) != 1 || p[0] != "theta" {
+		t.Fatal(c)
+	}
+
+	for _, v := range []float64{0.5, 1.5} {
+		bound, err := c.Bind(map[string]float64{"theta": v})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := q.New()
+		if err := got.Run(bound); err != nil {
+			t.Fatal(err)
+		}
+
+		want := q.New()
+		e0 := want.Zero()
+		e1 := want.Zero()
+		want.H(e0).RX(v, e0).RY(-v, e1).CNOT(e0, e1).RZ(2*v, e1).Phase(v, e0, e1)
+
+		if !got.DensityMatrix().Equals(want.DensityMatrix(), 1e-13) {
+			t.Errorf("%v: %v", got.Probability(), want.Probability())
+		}
+	}
+
+	unbound := q.New()
+	unbound.RXParam(theta, unbound.Zero())
+	if !errors.Is(unbound.Err(), q.ErrUnboundParameter) {
+		t.Error(unbound.Err())
+	}
+}
+
+func TestQSimControlled(t *testing.T) {
+	qsim := q.New()
+	q0 := qsim.Zero()
+	q1 := qsim.One()
+	q2 := qsim.Zero()
+	q3 := qsim.Zero()
+
+	qsim.H(q0, q2, q3)
+	qsim.Controlled(gate.Swap(2, 0, 1), []*q.Qubit{q0, q.Open(q2)}, q1, q3)
+	qsim.Controlled(gate.H(), []*q.Qubit{q.Open(q1)}, q3)
+	qsim.ControlledNot([]*q.Qubit{q.Open(q0), q2}, q1)
+
+	// open controls are controls between two X
+	expected := q.New()
+	e0 := expected.Zero()
+	e1 := expected.One()
+	e2 := expected.Zero()
+	e3 := expected.Zero()
+
+	expected.H(e0, e2, e3)
+	expected.X(e2)
+	expected.Exec(q.Instruction{Name: "swap", Control: []int{0, 2}, Target: []int{1, 3}})
+	expected.X(e2).X(e1)
+	expected.Exec(q.Instruction{Name: "h", Control: []int{1}, Target: []int{3}})
+	expected.X(e1).X(e0).ControlledNot([]*q.Qubit{e0, e2}, e1).X(e0)
+
+	if !qsim.DensityMatrix().Equals(expected.DensityMatrix(), 1e-13) {
+		t.Errorf("%v: %v", qsim.Probability(), expected.Probability())
+	}
+
+	in := qsim.Circuit().Instructions[3]
+	if in.Name != "unitary" || len(in.Control) != 1 || len(in.Open) != 1 || in.Open[0] != 2 {
+		t.Error(in)
+	}
+}
+
+func TestQSimApplyOn(t *testing.T) {
+	qsim := q.New()
+	q0 := qsim.Zero()
+	q1 := qsim.One()
+	q2 := qsim.Zero()
+	q3 := qsim.One()
+
+	qsim.H(q0, q2).RY(0.3, q3)
+	qsim.ApplyOn(gate.Toffoli(), q2, q0, q1)
+	qsim.ApplyOn(gate.Fredkin(), q3, q0, q2)
+	qsim.ApplyOn(gate.CNOT(2, 0, 1), q1, q0)
+	qsim.ApplyOn(gate.H(), q3)
+
+	expected := q.New()
+	e0 := expected.Zero()
+	e1 := expected.One()
+	e2 := expected.Zero()
+	e3 := expected.One()
+
+	expected.H(e0, e2).RY(0.3, e3)
+	expected.ControlledNot([]*q.Qubit{e2, e0}, e1)
+	expected.Exec(q.Instruction{Name: "swap", Control: []int{3}, Target: []int{0, 2}})
+	expected.CNOT(e1, e0)
+	expected.H(e3)
+
+	if !qsim.DensityMatrix().Equals(expected.DensityMatrix(), 1e-13) {
+		t.Errorf("%v: %v", qsim.Probability(), expected.Probability())
+	}
+}
+
+func TestQSimErr(t *testing.T) {
+	other := q.New()
+	o0 := other.Zero()
+
+	var test = []struct {
+		f   func(qsim *q.Q, q0, q1 *q.Qubit)
+		err error
+	}{
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.ApplyOn(gate.Toffoli(), q0, q1) }, q.ErrDimensionMismatch},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.Controlled(gate.CNOT(3, 0, 1), nil, q0, q1) }, q.ErrDimensionMismatch},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.ApplyOn(gate.CNOT(2, 0, 1), q0, q0) }, q.ErrDuplicateQubit},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.CNOT(q1, q1) }, q.ErrDuplicateQubit},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.Apply(gate.H()) }, q.ErrNoQubit},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.Apply(gate.H().Mul(2), q0) }, q.ErrNotUnitary},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.H(&q.Qubit{Index: 2}) }, q.ErrQubitOutOfRange},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.X(o0) }, q.ErrForeignQubit},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.New(0, 0) }, q.ErrZeroNorm},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.New(1, 0, 0) }, q.ErrDimensionMismatch},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.Apply(matrix.Matrix{{1, 0}, {0}}, q0) }, q.ErrDimensionMismatch},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.Apply(matrix.Matrix{{1, 0}, {0, 1, 0}}, q0) }, q.ErrDimensionMismatch},
+	}
+
+	for i, tt := range test {
+		qsim := q.New()
+		q0 := qsim.Zero()
+		q1 := qsim.Zero()
+
+		tt.f(qsim, q0, q1)
+		if !errors.Is(qsim.Err(), tt.err) {
+			t.Errorf("%d: %v", i, qsim.Err())
+		}
+
+		// the methods do nothing after an error
+		qsim.X(q0)
+		if !errors.Is(qsim.Err(), tt.err) || qsim.Measure(q0) != nil || len(qsim.Circuit().Instructions) > 0 {
+			t.Errorf("%d: %v", i, qsim.Circuit())
+		}
+	}
+}
+
+func TestQSimExecErr(t *testing.T) {
+	qsim := q.New()
+	qsim.Zero()
+
+	err := qsim.Exec(q.Instruction{Name: "x", Target: []int{1}})
+	if !errors.Is(err, q.ErrQubitOutOfRange) {
+		t.Error(err)
+	}
+
+	if qsim.Err() != nil {
+		t.Error(qsim.Err())
+	}
+
+	for _, in := range []q.Instruction{
+		{Name: "rx", Target: []int{0}},
+		{Name: "u3", Params: []float64{1, 2}, Target: []int{0}},
+		{Name: "r", Params: []float64{1, 2}, Target: []int{0}},
+	} {
+		if err := qsim.Exec(in); !errors.Is(err, q.ErrDimensionMismatch) {
+			t.Error(in, err)
+		}
+	}
+
+	empty := q.New()
+	if empty.Measure() != nil || !errors.Is(empty.Err(), q.ErrNoQubit) {
+		t.Error(empty.Err())
+	}
+
+	// Run and Exec return the error of a failed simulator
+	x := q.Instruction{Name: "x", Target: []int{0}}
+	if err := empty.Run(q.NewCircuit(1).Append(x)); !errors.Is(err, q.ErrNoQubit) {
+		t.Error(err)
+	}
+	if err := empty.Exec(x); !errors.Is(err, q.ErrNoQubit) {
+		t.Error(err)
+	}
+
+	c := q.NewCircuit(1).Append(x)
+	c.Init[0] = []complex128{0, 0}
+	if err := q.New().Run(c); !errors.Is(err, q.ErrZeroNorm) {
+		t.Error(err)
+	}
+}
+
+func TestQSimSeed(t *testing.T) {
+	run := func(qsim *q.Q) []int {
+		r := []*q.Qubit{qsim.Zero(), qsim.Zero(), qsim.Zero()}
+		for i := 0; i < 3; i++ {
+			qsim.H(r...).ApplyChannel(noise.BitFlip(0.3), r...)
+			qsim.Measure()
+			qsim.Reset(r...)
+		}
+
+		return qsim.Clbits()
+	}
+
+	var test = []struct {
+		q0, q1 *q.Q
+	}{
+		{q.New(q.WithRand(rand.NewSource(7))), q.New(q.WithRand(rand.NewSource(7)))},
+		{q.New().Seed(7), q.New(q.WithRand(rand.NewSource(7)))},
+		{q.New(q.WithDensityMatrix()).Seed(3), q.New(q.WithRand(rand.NewSource(3)), q.WithDensityMatrix())},
+	}
+
+	for _, tt := range test {
+		c0, c1 := run(tt.q0), run(tt.q1)
+		if fmt.Sprint(c0) != fmt.Sprint(c1) {
+			t.Errorf("%v: %v", c0, c1)
+		}
+	}
+}
+
+func TestQSimSample(t *testing.T) {
+	qsim := q.New(q.WithRand(rand.NewSource(1)))
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+
+	qsim.H(q0).CNOT(q0, q1).X(q2)
+	p := qsim.Probability()
+
+	var test = []struct {
+		input []*q.Qubit
+		keys  string
+	}{
+		{nil, "001 111"},
+		{[]*q.Qubit{q1, q0}, "00 11"},
+		{[]*q.Qubit{q2, q0}, "10 11"},
+		{[]*q.Qubit{q2}, "1"},
+	}
+
+	for _, tt := range test {
+		c := qsim.Sample(1000, tt.input...)
+		if c.Shots() != 1000 {
+			t.Error(c)
+		}
+
+		keys := []string{}
+		for _, k := range strings.Fields(c.String()) {
+			keys = append(keys, strings.Split(k, ":")[0])
+		}
+		if strings.Join(keys, " ") != tt.keys {
+			t.Errorf("%v: %v", c, tt.keys)
+		}
+
+		for _, f := range c.Probability() {
+			if len(keys) == 2 && math.Abs(f-0.5) > 0.1 {
+				t.Error(c)
+			}
+		}
+	}
+
+	// the register is not changed
+	if fmt.Sprint(qsim.Probability()) != fmt.Sprint(p) || len(qsim.Circuit().Instructions) != 3 {
+		t.Error(qsim.Circuit())
+	}
+
+	m0 := q.New().Seed(5)
+	m1 := q.New().Seed(5)
+	for _, m := range []*q.Q{m0, m1} {
+		m.H(m.Zero(), m.Zero())
+	}
+	if a, b := m0.Memory(20), m1.Memory(20); len(a) != 20 || fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Errorf("%v: %v", a, b)
+	}
+}
+
+func TestQSimSampleErr(t *testing.T) {
+	other := q.New()
+	o0 := other.Zero()
+
+	qsim := q.New()
+	if qsim.Sample(10) != nil {
+		t.Error("no qbits")
+	}
+
+	q0 := qsim.Zero()
+	for _, c := range []q.Counts{
+		qsim.Sample(-1),
+		qsim.Sample(10, &q.Qubit{Index: 3}),
+		qsim.Sample(10, o0),
+		qsim.Sample(10, nil),
+	} {
+		if c != nil {
+			t.Error(c)
+		}
+	}
+
+	// the simulator keeps working
+	qsim.X(q0)
+	if qsim.Err() != nil || qsim.Sample(10)["1"] != 10 {
+		t.Error(qsim.Err())
+	}
+}
+
+func TestQSimSampleReadout(t *testing.T) {
+	qsim := q.New(q.WithNoise(&q.NoiseModel{
+		Readout: map[int]q.Readout{0: {P01: 1}},
+	}))
+	qsim.Zero()
+	qsim.Zero()
+
+	if c := qsim.Sample(10); c["10"] != 10 {
+		t.Error(c)
+	}
+}
+
+func TestQSimRegister(t *testing.T) {
+	qsim := q.New()
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.One()
+
+	c := qsim.ClassicalRegister("c", 2)
+	d := qsim.ClassicalRegister("d", 1)
+
+	qsim.H(q0).MeasureTo(q0, c.Clbit[0])
+	qsim.IfRegister(c, 1).X(q1)
+	qsim.MeasureTo(q1, c.Clbit[1])
+	qsim.MeasureRegister(d, q2)
+
+	check := func(qsim *q.Q) {
+		if v := qsim.Value(c); v != 0 && v != 3 {
+			t.Error(v)
+		}
+		if b := qsim.Bitstring(c); b != "00" && b != "11" {
+			t.Error(b)
+		}
+		if qsim.Value(d) != 1 || qsim.Bitstring(d) != "1" {
+			t.Error(qsim.Clbits())
+		}
+	}
+	check(qsim)
+
+	// the condition is recorded even if the gate is not applied
+	circuit := qsim.Circuit()
+	in := circuit.Instructions[2]
+	if in.Condition == nil || fmt.Sprint(in.Condition.Clbit) != "[0 1]" || in.Condition.Value != 1 {
+		t.Error(circuit)
+	}
+
+	if len(circuit.Registers) != 2 || circuit.Clbits != 3 {
+		t.Error(circuit.Registers)
+	}
+
+	for i := 0; i < 10; i++ {
+		replay := q.New()
+		if err := replay.Run(circuit); err != nil {
+			t.Fatal(err)
+		}
+		check(replay)
+	}
+
+	if qsim.ClassicalRegister("c", 1) != nil || qsim.Err() == nil {
+		t.Error(qsim.Err())
+	}
+}
+
+func TestQSimReset(t *testing.T) {
+	qsim := q.New()
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.One()
+
+	qsim.H(q0).CNOT(q0, q1).Reset(q1, q2)
+
+	p := qsim.Probability()
+	if math.Abs(p[0]+p[4]-1) > 1e-13 {
+		t.Error(p)
+	}
+
+	if qsim.Circuit().Instructions[2].Name != "reset" {
+		t.Error(qsim.Circuit())
+	}
+}
+
+func TestQSimRelease(t *testing.T) {
+	for _, qsim := range []*q.Q{q.New(), q.New(q.WithDensityMatrix())} {
+		q0 := qsim.Zero()
+		q1 := qsim.Zero()
+		q2 := qsim.Zero()
+
+		qsim.H(q0).X(q1, q2).Release(q1)
+		if p := qsim.Probability(); fmt.Sprintf("%.2f", p) != "[0.00 0.50 0.00 0.50]" {
+			t.Error(p)
+		}
+
+		// the other qbits keep their indices
+		qsim.CNOT(q0, q2)
+		q3 := qsim.Zero()
+		qsim.X(q3)
+		if p := qsim.Probability(); fmt.Sprintf("%.2f", p) != "[0.00 0.00 0.00 0.50 0.00 0.50 0.00 0.00]" {
+			t.Error(p)
+		}
+
+		if c := qsim.Sample(10, q3, q2, q0); c["110"]+c["101"] != 10 {
+			t.Error(c)
+		}
+
+		if qsim.X(q1).Err() == nil {
+			t.Error(qsim.Circuit())
+		}
+	}
+
+	qsim := q.New()
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	qsim.H(q0).CNOT(q0, q1).Release(q1)
+	if !errors.Is(qsim.Err(), qubit.ErrEntangled) {
+		t.Error(qsim.Err())
+	}
+}
+
+func TestQSimExpectation(t *testing.T) {
+	for _, qsim := range []*q.Q{q.New(), q.New(q.WithDensityMatrix())} {
+		q0 := qsim.Zero()
+		q1 := qsim.Zero()
+		q2 := qsim.One()
+		qsim.H(q0).CNOT(q0, q1)
+
+		cases := []struct {
+			obs  string
+			want float64
+		}{
+			{"Z0Z1", 1},
+			{"X0X1", 1},
+			{"Y0Y1", -1},
+			{"Z0", 0},
+			{"Z2", -1},
+			{"0.5*Z0Z1 - 1.2*X2", 0.5},
+			{"2 - Z2 + X0X1Z2", 2},
+		}
+
+		for _, c := range cases {
+			if e := qsim.Expectation(pauli.MustParse(c.obs)); math.Abs(e-c.want) > 1e-13 {
+				t.Errorf("%v: %v", c.obs, e)
+			}
+		}
+
+		// the state is not measured
+		if p := qsim.Probability(); fmt.Sprintf("%.2f", p) != "[0.00 0.50 0.00 0.00 0.00 0.00 0.00 0.50]" {
+			t.Error(p)
+		}
+
+		// <ZZ> of the matrix equals Z0Z1
+		zz := gate.Z().TensorProduct(gate.Z())
+		if e := qsim.ExpectationMatrix(zz, q0, q1); math.Abs(e-1) > 1e-13 {
+			t.Error(e)
+		}
+		if e := qsim.ExpectationMatrix(gate.X(), q2); math.Abs(e) > 1e-13 {
+			t.Error(e)
+		}
+
+		qsim.Seed(1)
+		if e := qsim.EstimateExpectation(pauli.MustParse("0.5*Z0Z1 - Y0Y1 + 3"), 1000); math.Abs(e-4.5) > 1e-13 {
+			t.Error(e)
+		}
+		if e := qsim.EstimateExpectation(pauli.MustParse("X0"), 10000); math.Abs(e) > 0.05 {
+			t.Error(e)
+		}
+		if qsim.Err() != nil {
+			t.Error(qsim.Err())
+		}
+	}
+}
+
+func TestQSimExpectationErr(t *testing.T) {
+	cases := []struct {
+		f   func(qsim *q.Q, q0, q1 *q.Qubit) float64
+		err error
+	}{
+		{func(qsim *q.Q, q0, q1 *q.Qubit) float64 {
+			return qsim.Expectation(pauli.MustParse("Z2"))
+		}, q.ErrQubitOutOfRange},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) float64 {
+			return qsim.Expectation(pauli.Sum{pauli.New(1i, "Z")})
+		}, q.ErrNotHermitian},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) float64 {
+			return qsim.ExpectationMatrix(gate.S(), q0)
+		}, q.ErrNotHermitian},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) float64 {
+			return qsim.ExpectationMatrix(gate.X(), q0, q1)
+		}, q.ErrDimensionMismatch},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) float64 {
+			return qsim.Release(q1).EstimateExpectation(pauli.MustParse("X1"), 10)
+		}, q.ErrQubitOutOfRange},
+	}
+
+	for _, c := range cases {
+		qsim := q.New()
+		q0 := qsim.Zero()
+		q1 := qsim.Zero()
+
+		if e := c.f(qsim, q0, q1); e != 0 || !errors.Is(qsim.Err(), c.err) {
+			t.Errorf("%v %v", e, qsim.Err())
+		}
+	}
+}
+
+func TestQSimStabilizer(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 20; n++ {
+		qsim, want := q.New(q.WithStabilizer()), q.New()
+		for _, z := range [][]complex128{{1, 0}, {0, 1}, {1, 1}, {1, -1}, {1, 1i}} {
+			qsim.New(z...)
+			want.New(z...)
+		}
+
+		list := []q.Instruction{}
+		for i := 0; i < 60; i++ {
+			name := []string{"h", "x", "y", "z", "s", "sdg", "rx"}[rnd.Intn(7)]
+			in := q.Instruction{Name: name, Target: []int{rnd.Intn(5)}}
+			if name == "rx" {
+				in.Params = []float64{math.Pi / 2}
+			}
+
+			switch c := (in.Target[0] + 1 + rnd.Intn(4)) % 5; rnd.Intn(4) {
+			case 0:
+				in.Name = []string{"x", "y", "z"}[rnd.Intn(3)]
+				in.Control = []int{c}
+			case 1:
+				in.Name = []string{"x", "y", "z"}[rnd.Intn(3)]
+				in.Open = []int{c}
+			case 2:
+				in = q.Instruction{Name: "swap", Target: []int{in.Target[0], c}}
+			}
+
+			list = append(list, in)
+		}
+
+		if err := qsim.Exec(list...); err != nil {
+			t.Fatal(err)
+		}
+		want.Exec(list...)
+
+		if !qsim.DensityMatrix().Equals(want.DensityMatrix(), 1e-10) {
+			t.Errorf("%v", qsim.Circuit())
+		}
+
+		obs := pauli.MustParse("X0Y1 - 0.5*Z2Z3 + Y4 + X0X1X2X3X4")
+		if e, w := qsim.Expectation(obs), want.Expectation(obs); math.Abs(e-w) > 1e-10 {
+			t.Errorf("%v %v", e, w)
+		}
+	}
+}
+
+func TestQSimStabilizerLarge(t *testing.T) {
+	// a GHZ state of 1000 qbits
+	qsim := q.New(q.WithStabilizer()).Seed(1)
+	q0 := qsim.Zero()
+	qsim.H(q0)
+
+	qb := []*q.Qubit{q0}
+	for i := 1; i < 1000; i++ {
+		qb = append(qb, qsim.Zero())
+		qsim.CNOT(q0, qb[i])
+	}
+
+	one := qsim.Measure(qb[500]).IsOne()
+	for _, b := range qb {
+		if qsim.Measure(b).IsOne() != one {
+			t.Fatal(qsim.Clbits())
+		}
+	}
+}
+
+func TestQSimStabilizerSeed(t *testing.T) {
+	run := func(probability bool) []int {
+		qsim := q.New(q.WithStabilizer(), q.WithRand(rand.NewSource(1)))
+		r := []*q.Qubit{qsim.Zero(), qsim.Zero(), qsim.Zero()}
+		for i := 0; i < 10; i++ {
+			qsim.H(r...).CNOT(r[0], r[1])
+			if probability {
+				qsim.Probability()
+				qsim.DensityMatrix()
+			}
+			qsim.Measure()
+		}
+
+		return qsim.Clbits()
+	}
+
+	// the state vector does not draw from the source of the simulator
+	if c0, c1 := run(false), run(true); fmt.Sprint(c0) != fmt.Sprint(c1) {
+		t.Errorf("%v: %v", c0, c1)
+	}
+}
+
+func TestQSimStabilizerBitFlip(t *testing.T) {
+	qsim := q.New(q.WithStabilizer()).Seed(1)
+	for i := 0; i < 100; i++ {
+		q0 := qsim.One()
+		q1 := qsim.Zero()
+		q2 := qsim.Zero()
+		qsim.CNOT(q0, q1).CNOT(q0, q2)
+
+		// flip one of the qbits
+		qsim.X([]*q.Qubit{q0, q1, q2}[i%3])
+
+		a0 := qsim.Zero()
+		a1 := qsim.Zero()
+		qsim.CNOT(q0, a0).CNOT(q1, a0).CNOT(q1, a1).CNOT(q2, a1)
+		m0, m1 := qsim.Measure(a0).IsOne(), qsim.Measure(a1).IsOne()
+
+		qsim.ConditionX(m0 && !m1, q0)
+		qsim.ConditionX(m0 && m1, q1)
+		qsim.ConditionX(!m0 && m1, q2)
+
+		qsim.CNOT(q0, q1).CNOT(q0, q2)
+		if !qsim.Measure(q0).IsOne() || qsim.Measure(q1).IsOne() || qsim.Measure(q2).IsOne() {
+			t.Fatal(i)
+		}
+
+		for _, b := range []*q.Qubit{q0, q1, q2, a0, a1} {
+			qsim.Release(b)
+		}
+	}
+
+	if qsim.Err() != nil {
+		t.Error(qsim.Err())
+	}
+}
+
+func TestQSimStabilizerErr(t *testing.T) {
+	cases := []struct {
+		f func(qsim *q.Q, q0, q1 *q.Qubit)
+	}{
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.T(q0) }},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.ControlledR([]*q.Qubit{q0}, q1, 2) }},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.RX(0.1, q0) }},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.Controlled(gate.H(), []*q.Qubit{q0}, q1) }},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.ControlledNot([]*q.Qubit{q0, q1}, qsim.Zero()) }},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.ApplyChannel(noise.AmplitudeDamping(0.1), q0) }},
+		{func(qsim *q.Q, q0, q1 *q.Qubit) { qsim.New(1, 2) }},
+	}
+
+	for i, c := range cases {
+		qsim := q.New(q.WithStabilizer())
+		q0 := qsim.Zero()
+		q1 := qsim.Zero()
+
+		c.f(qsim, q0, q1)
+		if !errors.Is(qsim.Err(), q.ErrNotClifford) {
+			t.Errorf("%d: %v", i, qsim.Err())
+		}
+	}
+
+	qsim := q.New(q.WithStabilizer(), q.WithNoise(&q.NoiseModel{GateTime: map[string]float64{"h": 1}}))
+	if !errors.Is(qsim.Err(), q.ErrNotClifford) {
+		t.Error(qsim.Err())
+	}
+
+	// Pauli channels are sampled
+	qsim = q.New(q.WithStabilizer())
+	qsim.ApplyChannel(noise.Depolarizing(0.5), qsim.Zero())
+	if qsim.Err() != nil {
+		t.Error(qsim.Err())
+	}
+}
+
+func TestQSimMPS(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 10; n++ {
+		qsim, want := q.New(q.WithMPS(0, 0)), q.New()
+		qb, wb := []*q.Qubit{}, []*q.Qubit{}
+		for i := 0; i < 5; i++ {
+			z := []complex128{complex(rnd.Float64(), rnd.Float64()), complex(rnd.Float64(), rnd.Float64())}
+			qb = append(qb, qsim.New(z...))
+			wb = append(wb, want.New(z...))
+		}
+
+		list := []q.Instruction{}
+		for i := 0; i < 30; i++ {
+			name := []string{"h", "x", "y", "t", "rx", "ry"}[rnd.Intn(6)]
+			in := q.Instruction{Name: name, Target: []int{rnd.Intn(5)}}
+			if name == "rx" || name == "ry" {
+				in.Params = []float64{rnd.Float64() * math.Pi}
+			}
+
+			switch c := (in.Target[0] + 1 + rnd.Intn(4)) % 5; rnd.Intn(5) {
+			case 0:
+				in.Control = []int{c, (c + 1) % 5}
+				if in.Control[1] == in.Target[0] {
+					in.Control = in.Control[:1]
+				}
+			case 1:
+				in.Open = []int{c}
+			case 2:
+				in = q.Instruction{Name: "swap", Target: []int{in.Target[0], c}}
+			case 3:
+				in = q.Instruction{Name: "qft", Target: []int{c, in.Target[0]}}
+			}
+
+			list = append(list, in)
+		}
+
+		if err := qsim.Exec(list...); err != nil {
+			t.Fatal(err)
+		}
+		want.Exec(list...)
+
+		if !qsim.DensityMatrix().Equals(want.DensityMatrix(), 1e-10) {
+			t.Errorf("%v", qsim.Circuit())
+		}
+
+		obs := pauli.MustParse("X0Y1 - 0.5*Z2Z4 + Y3")
+		if e, w := qsim.Expectation(obs), want.Expectation(obs); math.Abs(e-w) > 1e-10 {
+			t.Errorf("%v %v", e, w)
+		}
+
+		zx := gate.Z().TensorProduct(gate.X())
+		if e, w := qsim.ExpectationMatrix(zx, qb[4], qb[1]), want.ExpectationMatrix(zx, wb[4], wb[1]); math.Abs(e-w) > 1e-10 {
+			t.Errorf("%v %v", e, w)
+		}
+
+		if e := qsim.TruncationError(); e > 1e-20 {
+			t.Error(e)
+		}
+	}
+}
+
+func TestQSimMPSLarge(t *testing.T) {
+	// a GHZ state of 100 qbits has bond dimension 2
+	qsim := q.New(q.WithMPS(2, 1e-12)).Seed(1)
+	qb := []*q.Qubit{qsim.Zero()}
+	qsim.H(qb[0])
+	for i := 1; i < 100; i++ {
+		qb = append(qb, qsim.Zero())
+		qsim.CNOT(qb[i-1], qb[i])
+	}
+
+	c := qsim.Sample(100)
+	if len(c) != 2 || c[strings.Repeat("0", 100)]+c[strings.Repeat("1", 100)] != 100 {
+		t.Error(c)
+	}
+
+	obs := pauli.MustParse("Z0Z99 + X0X1X2X3X4X5X6X7X8X9X10X11X12X13X14X15X16X17X18X19X20X21X22X23X24X25X26X27X28X29X30X31X32X33X34X35X36X37X38X39X40X41X42X43X44X45X46X47X48X49X50X51X52X53X54X55X56X57X58X59X60X61X62X63X64X65X66X67X68X69X70X71X72X73X74X75X76X77X78X79X80X81X82X83X84X85X86X87X88X89X90X91X92X93X94X95X96X97X98X99")
+	if e := qsim.Expectation(obs); math.Abs(e-2) > 1e-10 {
+		t.Error(e)
+	}
+
+	one := qsim.Measure(qb[50]).IsOne()
+	for _, b := range qb {
+		if qsim.Measure(b).IsOne() != one {
+			t.Fatal(qsim.Clbits())
+		}
+	}
+
+	if e := qsim.TruncationError(); e > 1e-10 || qsim.Err() != nil {
+		t.Error(e, qsim.Err())
+	}
+}
+
+func TestQSimMPSTruncation(t *testing.T) {
+	// a bond dimension of 1 keeps the larger half of a Schmidt decomposition
+	qsim := q.New(q.WithMPS(1, 0))
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	qsim.RY(math.Pi/3, q0).CNOT(q0, q1)
+
+	if e := qsim.TruncationError(); math.Abs(e-0.25) > 1e-10 {
+		t.Error(e)
+	}
+
+	if p := qsim.Probability(); fmt.Sprintf("%.2f", p) != "[1.00 0.00 0.00 0.00]" {
+		t.Error(p)
+	}
+
+	// the threshold discards small weights only
+	qsim = q.New(q.WithMPS(0, 0.3))
+	q0 = qsim.Zero()
+	q1 = qsim.Zero()
+	qsim.RY(math.Pi/3, q0).CNOT(q0, q1).RY(-math.Pi/3, q0)
+	if e := qsim.TruncationError(); math.Abs(e-0.25) > 1e-10 {
+		t.Error(e)
+	}
+
+	qsim = q.New(q.WithMPS(0, 0.2))
+	q0 = qsim.Zero()
+	q1 = qsim.Zero()
+	qsim.RY(math.Pi/3, q0).CNOT(q0, q1)
+	if e := qsim.TruncationError(); e != 0 {
+		t.Error(e)
+	}
+}
+
+func TestQSimMPSRelease(t *testing.T) {
+	qsim := q.New(q.WithMPS(0, 0))
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+
+	qsim.H(q0).X(q1).CNOT(q0, q2).Release(q1)
+	if p := qsim.Probability(); fmt.Sprintf("%.2f", p) != "[0.50 0.00 0.00 0.50]" {
+		t.Error(p)
+	}
+
+	qsim.Release(q0)
+	if !errors.Is(qsim.Err(), qubit.ErrEntangled) {
+		t.Error(qsim.Err())
+	}
+}
+
+// counter counts the gates applied to the backend it wraps.
+type counter struct {
+	q.Backend
+	gates int
+}
+
+func (c *counter) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) {
+	c.gates++
+	c.Backend.ApplyControlled(u, control, open, target...)
+}
+
+// noT is a backend that rejects T gates.
+type noT struct {
+	q.Backend
+}
+
+func (b noT) Validate(in q.Instruction) error {
+	if in.Name == "t" {
+		return errors.New("no T")
+	}
+
+	return nil
+}
+
+func TestQSimBackend(t *testing.T) {
+	c := &counter{Backend: q.NewStateVector()}
+	qsim := q.New(q.WithBackend(c))
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	qsim.H(q0).CNOT(q0, q1)
+
+	if c.gates != 2 {
+		t.Error(c.gates)
+	}
+	if p := qsim.Probability(); fmt.Sprintf("%.2f", p) != "[0.50 0.00 0.00 0.50]" {
+		t.Error(p)
+	}
+
+	qsim = q.New(q.WithBackend(noT{q.NewDensityMatrix()}))
+	q0 = qsim.Zero()
+	qsim.H(q0).T(q0)
+	if qsim.Err() == nil || qsim.Err().Error() != "no T" {
+		t.Error(qsim.Err())
+	}
+
+	b := q.NewStateVector()
+	b.Add(1, 0)
+	if q.New(q.WithBackend(b)).Err() == nil {
+		t.Error("a backend with qbits")
+	}
+}
+
+func TestQSimDryRun(t *testing.T) {
+	d := q.NewDryRun()
+	qsim := q.New(q.WithBackend(d), q.WithNoise(&q.NoiseModel{Gate: map[string]float64{"cx": 0.1}}))
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+
+	qsim.H(q0).CNOT(q0, q1).ControlledNot([]*q.Qubit{q0, q1}, q2).QFT()
+	m := qsim.Measure(q1)
+	qsim.Release(q1)
+
+	got := []string{}
+	for _, op := range d.Operations {
+		got = append(got, fmt.Sprintf("%s %v %v %v", op.Name, op.Control, op.Open, op.Target))
+	}
+
+	want := []string{
+		"add [] [] [0]", "add [] [] [1]", "add [] [] [2]",
+		"apply [] [] [0]",
+		"apply [0] [] [1]", "kraus [] [] [1]", "kraus [] [] [0]",
+		"apply [0 1] [] [2]", "kraus [] [] [2]", "kraus [] [] [0]", "kraus [] [] [1]",
+		// QFT of 3 qbits
+		"apply [] [] [0]", "apply [1] [] [0]", "apply [2] [] [0]",
+		"apply [] [] [1]", "apply [2] [] [1]",
+		"apply [] [] [2]", "swap [] [] [0 2]",
+		"measure [] [] [1]", "release [] [] [1]",
+	}
+
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Error(strings.Join(got, "\n"))
+	}
+
+	if !m.IsZero() || qsim.Probability() != nil || qsim.Err() != nil {
+		t.Error(m, qsim.Err())
+	}
+
+	if c := qsim.Sample(10); c["00"] != 10 {
+		t.Error(c)
+	}
+}
+
+func TestQSimWorkers(t *testing.T) {
+	run := func(workers int) (*q.Q, []float64) {
+		qsim := q.New(q.WithWorkers(workers), q.WithRand(rand.NewSource(1)))
+		r := []*q.Qubit{}
+		for i := 0; i < 15; i++ {
+			r = append(r, qsim.Zero())
+		}
+
+		qsim.H(r...).RX(0.3, r[2]).CNOT(r[0], r[14]).ControlledNot(r[3:6], r[1]).Swap(r[4], r[11])
+		qsim.Measure(r[7])
+
+		return qsim, qsim.Probability()
+	}
+
+	q0, p0 := run(1)
+	q1, p1 := run(4)
+
+	for i := range p0 {
+		if math.Abs(p0[i]-p1[i]) > 1e-13 {
+			t.Fatal(i, p0[i], p1[i])
+		}
+	}
+
+	if s0, s1 := q0.Sample(1000).String(), q1.Sample(1000).String(); s0 != s1 {
+		t.Error(s0, s1)
+	}
+}
+
+func BenchmarkQSimSample(b *testing.B) {
+	for _, n := range []int{16, 20, 24, 28} {
+		for _, w := range []int{1, 0} {
+			b.Run(fmt.Sprintf("qbits=%d/workers=%d", n, w), func(b *testing.B) {
+				qsim := q.New(q.WithWorkers(w))
+				for i := 0; i < n; i++ {
+					qsim.H(qsim.Zero())
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					qsim.Sample(1024)
+				}
+			})
+		}
+	}
+}
+
+func TestQSimFusion(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 20; n++ {
+		list := []q.Instruction{}
+		for i := 0; i < 60; i++ {
+			name := []string{"h", "x", "t", "s", "ry", "u3"}[rnd.Intn(6)]
+			in := q.Instruction{Name: name, Target: []int{rnd.Intn(5)}}
+			switch name {
+			case "ry":
+				in.Params = []float64{rnd.Float64()}
+			case "u3":
+				in.Params = []float64{rnd.Float64(), rnd.Float64(), rnd.Float64()}
+			}
+
+			switch c := (in.Target[0] + 1 + rnd.Intn(4)) % 5; rnd.Intn(8) {
+			case 0:
+				in.Control = []int{c}
+			case 1:
+				in.Open = []int{c}
+			case 2:
+				in = q.Instruction{Name: "swap", Target: []int{in.Target[0], c}}
+			case 3:
+				in = q.Instruction{Name: "measure", Target: []int{in.Target[0]}, Clbit: []int{c}}
+			case 4:
+				in.Condition = &q.Condition{Clbit: []int{c}, Value: 1}
+			}
+
+			list = append(list, in)
+		}
+
+		run := func(opt ...q.Option) *q.Q {
+			qsim := q.New(append(opt, q.WithRand(rand.NewSource(int64(n))))...)
+			for i := 0; i < 5; i++ {
+				qsim.Zero()
+			}
+
+			if err := qsim.Exec(list...); err != nil {
+				t.Fatal(err)
+			}
+
+			return qsim
+		}
+
+		want := run()
+		for _, k := range []int{1, 2, 3} {
+			got := run(q.WithFusion(k))
+			if !got.DensityMatrix().Equals(want.DensityMatrix(), 1e-10) || fmt.Sprint(got.Clbits()) != fmt.Sprint(want.Clbits()) {
+				t.Errorf("k=%d: %v", k, got.Circuit())
+			}
+		}
+
+		noise := &q.NoiseModel{Gate: map[string]float64{"cx": 0.05, "swap": 0.05}}
+		want = run(q.WithDensityMatrix(), q.WithNoise(noise))
+		got := run(q.WithDensityMatrix(), q.WithNoise(noise), q.WithFusion(2))
+		if !got.DensityMatrix().Equals(want.DensityMatrix(), 1e-10) {
+			t.Errorf("density: %v", got.Circuit())
+		}
+	}
+}
+
+func TestQSimFusionGates(t *testing.T) {
+	cases := []struct {
+		k     int
+		gates int
+	}{
+		{0, 7},
+		{1, 4},
+		{2, 2},
+		{3, 1},
+	}
+
+	for _, c := range cases {
+		b := &counter{Backend: q.NewStateVector()}
+		qsim := q.New(q.WithBackend(b), q.WithFusion(c.k))
+		q0 := qsim.Zero()
+		q1 := qsim.Zero()
+		q2 := qsim.Zero()
+
+		// H Z H on q0, CNOT and H H on q1, Toffoli
+		qsim.H(q0).Z(q0).H(q0).CNOT(q0, q1).H(q1).H(q1)
+		qsim.ControlledNot([]*q.Qubit{q0, q1}, q2)
+
+		if p := qsim.Probability(); fmt.Sprintf("%.2f", p) != "[0.00 0.00 0.00 0.00 0.00 0.00 0.00 1.00]" {
+			t.Errorf("k=%d: %v", c.k, p)
+		}
+
+		if b.gates != c.gates {
+			t.Errorf("k=%d: %d gates", c.k, b.gates)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package qasm
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/axamon/q"
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+)
+
+// Export returns the OpenQASM 2.0 source of the circuit.
+// The qbits are written on the register q. The initial states
+// other than |0> are prepared with u3, QFT is written as its gates and
+// the gates qelib1.inc does not define are decomposed into u1, u3, cu3 and cx.
+func Export(c *q.Circuit) (string, error) {
+	var b strings.Builder
+	b.WriteString("OPENQASM 2.0;\n")
+	b.WriteString("include \"qelib1.inc\";\n")
+
+	if c.NumberOfBit() > 0 {
+		fmt.Fprintf(&b, "qreg q[%d];\n", c.NumberOfBit())
+	}
+
+	regs := registers(c)
+	clbit := map[int]string{}
+	for _, r := range regs {
+		fmt.Fprintf(&b, "creg %s[%d];\n", r.Name, len(r.Clbit))
+		for i, cb := range r.Clbit {
+			clbit[cb] = fmt.Sprintf("%s[%d]", r.Name, i)
+		}
+	}
+
+	for i, z := range c.Init {
+		if z == nil {
+			continue
+		}
+
+		theta, phi := prepare(z)
+		if theta == 0 {
+			continue
+		}
+
+		if theta == math.Pi && phi == 0 {
+			fmt.Fprintf(&b, "x q[%d];\n", i)
+			continue
+		}
+
+		fmt.Fprintf(&b, "u3(%s,%s,0) q[%d];\n", format(theta), format(phi), i)
+	}
+
+	for _, in := range c.Instructions {
+		prefix := ""
+		if in.Condition != nil {
+			name, ok := condition(regs, in.Condition)
+			if !ok {
+				return "", fmt.Errorf("condition on %v: %w", in.Condition.Clbit, ErrNotSupported)
+			}
+			prefix = fmt.Sprintf("if(%s==%d) ", name, in.Condition.Value)
+		}
+
+		lines, err := instruction(in, clbit)
+		if err != nil {
+			return "", err
+		}
+
+		for _, l := range lines {
+			b.WriteString(prefix + l + ";\n")
+		}
+	}
+
+	return b.String(), nil
+}
+
+// registers returns the registers of the circuit. The classical bits
+// not in any register are written on the register c.
+func registers(c *q.Circuit) []q.Register {
+	regs := append([]q.Register{}, c.Registers...)
+
+	used := map[int]bool{}
+	for _, r := range regs {
+		for _, cb := range r.Clbit {
+			used[cb] = true
+		}
+	}
+
+	rest := q.Register{Name: "c"}
+	for i := 0; i < c.Clbits; i++ {
+		if !used[i] {
+			rest.Clbit = append(rest.Clbit, i)
+		}
+	}
+
+	if len(rest.Clbit) > 0 {
+		for _, r := range regs {
+			if r.Name == rest.Name {
+				rest.Name = "c" + strconv.Itoa(len(regs))
+			}
+		}
+		regs = append(regs, rest)
+	}
+
+	return regs
+}
+
+// condition returns the register whose bits are the bits of the condition.
+func condition(regs []q.Register, c *q.Condition) (string, bool) {
+	for _, r := range regs {
+		if reflect.DeepEqual(r.Clbit, c.Clbit) {
+			return r.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// prepare returns the angles of u3(theta, phi, 0)|0> equal to the amplitudes.
+func prepare(z []complex128) (float64, float64) {
+	norm := math.Sqrt(math.Pow(cmplx.Abs(z[0]), 2) + math.Pow(cmplx.Abs(z[1]), 2))
+	theta := 2 * math.Acos(math.Min(cmplx.Abs(z[0])/norm, 1))
+
+	phi := 0.0
+	if cmplx.Abs(z[1]) > 0 {
+		phi = cmplx.Phase(z[1])
+		if cmplx.Abs(z[0]) > 0 {
+			phi = phi - cmplx.Phase(z[0])
+		}
+	}
+
+	return theta, phi
+}
+
+func instruction(in q.Instruction, clbit map[int]string) ([]string, error) {
+	if len(in.Symbols) > 0 {
+		return nil, fmt.Errorf("%v: %w", in, q.ErrUnboundParameter)
+	}
+
+	u := in.Unitary()
+
+	// open controls are controls between two x
+	if len(in.Open) > 0 {
+		flip := []string{}
+		for _, o := range in.Open {
+			flip = append(flip, fmt.Sprintf("x q[%d]", o))
+		}
+
+		in.Control = append(append([]int{}, in.Control...), in.Open...)
+		in.Open = nil
+		lines, err := instruction(in, clbit)
+		if err != nil {
+			return nil, err
+		}
+		return append(append(flip, lines...), flip...), nil
+	}
+
+	// a 2x2 matrix acts on each target, a larger one on all of them
+	if u != nil && len(in.Target) > 1 {
+		if len(u) > 2 {
+			return nil, fmt.Errorf("%v: %w", in, ErrNotSupported)
+		}
+
+		lines := []string{}
+		for _, t := range in.Target {
+			one := in
+			one.Target = []int{t}
+			l, err := instruction(one, clbit)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, l...)
+		}
+		return lines, nil
+	}
+
+	switch in.Name {
+	case "measure":
+		lines := []string{}
+		for i, t := range in.Target {
+			lines = append(lines, fmt.Sprintf("measure q[%d] -> %s", t, clbit[in.Clbit[i]]))
+		}
+		return lines, nil
+	case "reset":
+		lines := []string{}
+		for _, t := range in.Target {
+			lines = append(lines, fmt.Sprintf("reset q[%d]", t))
+		}
+		return lines, nil
+	case "barrier":
+		return []string{"barrier " + qubits(in.Target)}, nil
+	case "qft", "iqft":
+		lines := []string{}
+		for _, i := range expand(in) {
+			l, err := instruction(i, clbit)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, l...)
+		}
+		return lines, nil
+	case "r":
+		in.Name = "p"
+		in.Params = []float64{2 * math.Pi / math.Pow(2, in.Params[0])}
+	}
+
+	list, ok := names[in.Name]
+	if !ok || len(in.Control) >= len(list) {
+		if u == nil {
+			return nil, fmt.Errorf("%v: %w", in, ErrNotSupported)
+		}
+
+		lines := []string{}
+		for _, i := range decompose(u, in.Control, in.Target[0]) {
+			l, err := instruction(i, clbit)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, l...)
+		}
+		return lines, nil
+	}
+
+	name := list[len(in.Control)]
+	if len(in.Params) > 0 {
+		p := []string{}
+		for _, v := range in.Params {
+			p = append(p, format(v))
+		}
+		name = name + "(" + strings.Join(p, ",") + ")"
+	}
+
+	return []string{name + " " + qubits(append(append([]int{}, in.Control...), in.Target...))}, nil
+}
+
+// expand returns the gates of the QFT in the order q.Q applies them.
+func expand(in q.Instruction) []q.Instruction {
+	bit := in.Target
+	n := len(bit)
+
+	list := []q.Instruction{}
+	for i := 0; i < n; i++ {
+		list = append(list, q.Instruction{Name: "h", Target: []int{bit[i]}})
+
+		k := 2
+		for j := i + 1; j < n; j++ {
+			list = append(list, q.Instruction{
+				Name:    "r",
+				Params:  []float64{float64(k)},
+				Control: []int{bit[j]},
+				Target:  []int{bit[i]},
+			})
+			k++
+		}
+	}
+
+	for i := 0; i < n/2; i++ {
+		list = append(list, q.Instruction{Name: "swap", Target: []int{bit[i], bit[n-1-i]}})
+	}
+
+	if in.Name == "qft" {
+		return list
+	}
+
+	inv := []q.Instruction{}
+	for i := len(list) - 1; i > -1; i-- {
+		in := list[i]
+		if in.Name == "r" {
+			in.Name = "p"
+			in.Params = []float64{-2 * math.Pi / math.Pow(2, in.Params[0])}
+		}
+		inv = append(inv, in)
+	}
+
+	return inv
+}
+
+// decompose returns the gates of qelib1.inc equal to the controlled 2x2 matrix.
+// More than two controls are reduced with V^2 = U as in Barenco et al.
+func decompose(u matrix.Matrix, control []int, target int) []q.Instruction {
+	n := len(control)
+	if n == 0 || n == 1 {
+		alpha, theta, phi, lambda := zyz(u)
+		list := []q.Instruction{}
+		if n == 1 && alpha != 0 {
+			list = append(list, q.Instruction{Name: "p", Params: []float64{alpha}, Target: []int{control[0]}})
+		}
+
+		return append(list, q.Instruction{
+			Name:    "u3",
+			Params:  []float64{theta, phi, lambda},
+			Control: control,
+			Target:  []int{target},
+		})
+	}
+
+	v := sqrt(u)
+	c, last := control[:n-1], control[n-1]
+	cx := q.Instruction{Name: "x", Control: c, Target: []int{last}}
+
+	list := decompose(v, []int{last}, target)
+	list = append(list, cx)
+	list = append(list, decompose(v.Dagger(), []int{last}, target)...)
+	list = append(list, cx)
+	return append(list, decompose(v, c, target)...)
+}
+
+// zyz returns the angles of u = e^(i alpha) u3(theta, phi, lambda).
+func zyz(u matrix.Matrix) (float64, float64, float64, float64) {
+	eps := 1e-13
+	theta := 2 * math.Atan2(cmplx.Abs(u[1][0]), cmplx.Abs(u[0][0]))
+
+	if cmplx.Abs(u[0][0]) < eps {
+		alpha := cmplx.Phase(u[1][0])
+		return alpha, theta, 0, cmplx.Phase(-u[0][1]) - alpha
+	}
+
+	alpha := cmplx.Phase(u[0][0])
+	if cmplx.Abs(u[1][0]) < eps {
+		return alpha, theta, 0, cmplx.Phase(u[1][1]) - alpha
+	}
+
+	return alpha, theta, cmplx.Phase(u[1][0]) - alpha, cmplx.Phase(-u[0][1]) - alpha
+}
+
+// sqrt returns the square root (M + sI)/t of the 2x2 matrix
+// where s^2 = det(M) and t^2 = tr(M) + 2s.
+func sqrt(u matrix.Matrix) matrix.Matrix {
+	det := u[0][0]*u[1][1] - u[0][1]*u[1][0]
+
+	s := cmplx.Sqrt(det)
+	t := cmplx.Sqrt(u.Trace() + 2*s)
+	if cmplx.Abs(t) < 1e-13 {
+		s = -s
+		t = cmplx.Sqrt(u.Trace() + 2*s)
+	}
+
+	return u.Add(gate.I().Mul(s)).Mul(1 / t)
+}
+
+func qubits(bit []int) string {
+	list := []string{}
+	for _, b := range bit {
+		list = append(list, fmt.Sprintf("q[%d]", b))
+	}
+
+	return strings.Join(list, ",")
+}
+
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,119 @@
+package qasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+type kind int
+
+const (
+	eof kind = iota
+	ident
+	number
+	str
+	symbol
+)
+
+type token struct {
+	kind kind
+	text string
+	line int
+}
+
+func (t token) String() string {
+	if t.kind == eof {
+		return "end of file"
+	}
+
+	return fmt.Sprintf("%q", t.text)
+}
+
+// symbols are the operators and punctuation, longest first.
+var symbols = []string{
+	"->", "==", "!=", "<=", ">=", "&&", "||", "+=", "-=", "*=", "/=", "**",
+	";", ",", "(", ")", "[", "]", "{", "}", "+", "-", "*", "/", "%", "^",
+	"<", ">", "=", "!", ":", "@",
+}
+
+// lex splits the source into tokens skipping comments.
+func lex(src string) ([]token, error) {
+	tokens := []token{}
+	line := 1
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			j := strings.Index(src[i:], "*/")
+			if j < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line = line + strings.Count(src[i:i+j], "\n")
+			i = i + j + 2
+		case c == '"':
+			j := strings.IndexByte(src[i+1:], '"')
+			if j < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{str, src[i+1 : i+1+j], line})
+			i = i + j + 2
+		case isLetter(c):
+			j := i
+			for j < len(src) && (isLetter(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, token{ident, src[i:j], line})
+			i = j
+		case isDigit(c) || c == '.' && i+1 < len(src) && isDigit(src[i+1]):
+			j := i
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.') {
+				j++
+			}
+			if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+				j++
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				for j < len(src) && isDigit(src[j]) {
+					j++
+				}
+			}
+			tokens = append(tokens, token{number, src[i:j], line})
+			i = j
+		default:
+			found := false
+			for _, s := range symbols {
+				if strings.HasPrefix(src[i:], s) {
+					tokens = append(tokens, token{symbol, s, line})
+					i = i + len(s)
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return nil, fmt.Errorf("line %d: unexpected %q", line, c)
+			}
+		}
+	}
+
+	return append(tokens, token{eof, "", line}), nil
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,800 @@
+package qasm
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+type stmt interface{}
+
+// regDecl declares a quantum or classical register.
+// init assigns the initial value of a classical register.
+type regDecl struct {
+	quantum bool
+	name    string
+	size    int
+	init    *assignStmt
+	line    int
+}
+
+// varDecl declares a classical variable of type int, uint, float, angle or bool.
+type varDecl struct {
+	typ  string
+	name string
+	init expr
+	line int
+}
+
+// gateDecl defines a gate made of other gates.
+type gateDecl struct {
+	name   string
+	params []string
+	args   []string
+	body   []stmt
+	line   int
+}
+
+type gateCall struct {
+	mods   []modifier
+	name   string
+	params []expr
+	args   []arg
+	line   int
+}
+
+// modifier is ctrl, negctrl, inv or pow with its argument, if any.
+type modifier struct {
+	kind string
+	arg  expr
+}
+
+type measureStmt struct {
+	q, c arg
+	line int
+}
+
+type resetStmt struct {
+	q    arg
+	line int
+}
+
+type barrierStmt struct {
+	args []arg
+	line int
+}
+
+// assignStmt assigns the value to the variable or to the classical bits.
+// The value is a measurement if measure is true.
+type assignStmt struct {
+	target  arg
+	op      string
+	value   expr
+	measure bool
+	q       arg
+	line    int
+}
+
+// ifStmt executes then if the condition holds and els otherwise.
+type ifStmt struct {
+	cond expr
+	then stmt
+	els  stmt
+	line int
+}
+
+type whileStmt struct {
+	cond expr
+	body stmt
+	line int
+}
+
+// forStmt executes the body for each value of the range or of the set.
+type forStmt struct {
+	name             string
+	start, step, end expr
+	set              []expr
+	body             stmt
+	line             int
+}
+
+type breakStmt struct {
+	line int
+}
+
+type continueStmt struct {
+	line int
+}
+
+// block is a list of statements between braces.
+// The variables declared in the block are not visible outside.
+type block []stmt
+
+// arg is a register or, if index is not nil, one of its bits.
+type arg struct {
+	name  string
+	index expr
+}
+
+type expr interface{}
+
+type num float64
+
+type name string
+
+// index is a bit of a classical register.
+type index struct {
+	name string
+	i    expr
+}
+
+type unary struct {
+	op string
+	x  expr
+}
+
+type binary struct {
+	op   string
+	x, y expr
+}
+
+type call struct {
+	fn string
+	x  expr
+}
+
+type program struct {
+	version string
+	stmts   []stmt
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseError is raised by the parser and recovered by parse.
+type parseError struct {
+	err error
+}
+
+func parse(src string) (prog *program, err error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(parseError)
+			if !ok {
+				panic(r)
+			}
+			prog, err = nil, e.err
+		}
+	}()
+
+	p := &parser{tokens: tokens}
+	return p.program(), nil
+}
+
+func (p *parser) errorf(format string, a ...interface{}) {
+	line := p.peek().line
+	panic(parseError{fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, a...))})
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != eof {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the token if it is the text.
+func (p *parser) accept(text string) bool {
+	t := p.peek()
+	if t.kind != str && t.kind != eof && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) {
+	if !p.accept(text) {
+		p.errorf("expected %q, found %v", text, p.peek())
+	}
+}
+
+func (p *parser) ident() string {
+	t := p.next()
+	if t.kind != ident {
+		p.errorf("expected identifier, found %v", t)
+	}
+	return t.text
+}
+
+func (p *parser) integer() int {
+	t := p.next()
+	v, err := strconv.Atoi(t.text)
+	if t.kind != number || err != nil {
+		p.errorf("expected integer, found %v", t)
+	}
+	return v
+}
+
+func (p *parser) program() *program {
+	prog := &program{}
+
+	p.expect("OPENQASM")
+	t := p.next()
+	if t.kind != number {
+		p.errorf("expected version, found %v", t)
+	}
+	prog.version = t.text
+	p.expect(";")
+
+	for p.peek().kind != eof {
+		if s := p.statement(); s != nil {
+			prog.stmts = append(prog.stmts, s)
+		}
+	}
+
+	return prog
+}
+
+// types are the classical types of OpenQASM 3 other than bit.
+var types = map[string]bool{
+	"int":   true,
+	"uint":  true,
+	"float": true,
+	"angle": true,
+	"bool":  true,
+}
+
+// assignments are the assignment operators.
+var assignments = map[string]bool{
+	"=":  true,
+	"+=": true,
+	"-=": true,
+	"*=": true,
+	"/=": true,
+}
+
+func (p *parser) statement() stmt {
+	line := p.peek().line
+
+	switch {
+	case p.accept("include"):
+		if t := p.next(); t.kind != str {
+			p.errorf("expected file name, found %v", t)
+		}
+		p.expect(";")
+		return nil
+	case p.accept("qreg"):
+		return p.register(true, line)
+	case p.accept("creg"):
+		return p.register(false, line)
+	case p.accept("qubit"):
+		return p.declaration(true, line)
+	case p.accept("bit"):
+		return p.declaration(false, line)
+	case p.accept("gate"):
+		return p.gate(line)
+	case p.accept("opaque"):
+		p.errorf("opaque gates are not supported")
+	case p.accept("if"):
+		s := &ifStmt{cond: p.condition(), line: line}
+		s.then = p.body()
+		if p.accept("else") {
+			s.els = p.body()
+		}
+		return s
+	case p.accept("while"):
+		return &whileStmt{p.condition(), p.body(), line}
+	case p.accept("for"):
+		return p.loop(line)
+	case p.accept("break"):
+		p.expect(";")
+		return &breakStmt{line}
+	case p.accept("continue"):
+		p.expect(";")
+		return &continueStmt{line}
+	case p.peek().kind == symbol && p.peek().text == "{":
+		return p.body()
+	}
+
+	if t := p.peek(); t.kind == ident && types[t.text] {
+		p.next()
+		return p.variable(t.text, line)
+	}
+
+	if p.peek().kind == ident && p.pos+1 < len(p.tokens) {
+		if t := p.tokens[p.pos+1]; t.kind == symbol && (t.text == "[" || assignments[t.text]) {
+			return p.assignment(line)
+		}
+	}
+
+	return p.operation()
+}
+
+// operation parses measure, reset, barrier and gate calls.
+func (p *parser) operation() stmt {
+	line := p.peek().line
+
+	switch {
+	case p.accept("measure"):
+		q := p.arg()
+		p.expect("->")
+		c := p.arg()
+		p.expect(";")
+		return &measureStmt{q, c, line}
+	case p.accept("reset"):
+		q := p.arg()
+		p.expect(";")
+		return &resetStmt{q, line}
+	case p.accept("barrier"):
+		args := p.args()
+		p.expect(";")
+		return &barrierStmt{args, line}
+	}
+
+	g := &gateCall{line: line}
+	for {
+		t := p.peek()
+		if t.kind != ident || t.text != "ctrl" && t.text != "negctrl" && t.text != "inv" && t.text != "pow" {
+			break
+		}
+		p.next()
+
+		m := modifier{kind: t.text}
+		if p.accept("(") {
+			m.arg = p.expr()
+			p.expect(")")
+		}
+		if m.kind == "pow" && m.arg == nil {
+			p.errorf("expected exponent of pow")
+		}
+		p.expect("@")
+
+		g.mods = append(g.mods, m)
+	}
+
+	g.name = p.ident()
+	if p.accept("(") {
+		g.params = p.exprs()
+		p.expect(")")
+	}
+	g.args = p.args()
+	p.expect(";")
+
+	return g
+}
+
+func (p *parser) register(quantum bool, line int) stmt {
+	r := &regDecl{quantum: quantum, name: p.ident(), line: line}
+	p.expect("[")
+	r.size = p.integer()
+	p.expect("]")
+	p.expect(";")
+	return r
+}
+
+// declaration parses "qubit[n] q;" and "bit[n] c;".
+// A bit may be initialized with a measurement as in "bit c = measure q;".
+func (p *parser) declaration(quantum bool, line int) stmt {
+	r := &regDecl{quantum: quantum, size: 1, line: line}
+	if p.accept("[") {
+		r.size = p.integer()
+		p.expect("]")
+	}
+	r.name = p.ident()
+
+	if !quantum && p.accept("=") {
+		r.init = &assignStmt{target: arg{name: r.name}, op: "=", line: line}
+		if p.accept("measure") {
+			r.init.measure, r.init.q = true, p.arg()
+		} else {
+			r.init.value = p.expr()
+		}
+	}
+
+	p.expect(";")
+	return r
+}
+
+// variable parses the declaration of a classical variable.
+// The size of the type, as in int[32], is ignored.
+func (p *parser) variable(typ string, line int) stmt {
+	if p.accept("[") {
+		p.integer()
+		p.expect("]")
+	}
+
+	v := &varDecl{typ: typ, name: p.ident(), line: line}
+	if p.accept("=") {
+		v.init = p.expr()
+	}
+	p.expect(";")
+
+	return v
+}
+
+func (p *parser) assignment(line int) stmt {
+	s := &assignStmt{target: p.arg(), line: line}
+
+	t := p.next()
+	if t.kind != symbol || !assignments[t.text] {
+		p.errorf("expected assignment, found %v", t)
+	}
+	s.op = t.text
+
+	if s.op == "=" && p.accept("measure") {
+		s.measure, s.q = true, p.arg()
+	} else {
+		s.value = p.expr()
+	}
+	p.expect(";")
+
+	return s
+}
+
+// condition parses the parenthesized condition of if and while.
+func (p *parser) condition() expr {
+	p.expect("(")
+	x := p.expr()
+	p.expect(")")
+	return x
+}
+
+// body parses a block or a single statement.
+func (p *parser) body() stmt {
+	if !p.accept("{") {
+		return p.statement()
+	}
+
+	b := block{}
+	for !p.accept("}") {
+		if p.peek().kind == eof {
+			p.errorf("expected %q, found %v", "}", p.peek())
+		}
+		if s := p.statement(); s != nil {
+			b = append(b, s)
+		}
+	}
+
+	return b
+}
+
+// loop parses "for i in [start:end]", "for i in [start:step:end]"
+// and "for i in {a, b, c}". The type of the variable may precede its name.
+func (p *parser) loop(line int) stmt {
+	if t := p.peek(); t.kind == ident && types[t.text] {
+		p.next()
+		if p.accept("[") {
+			p.integer()
+			p.expect("]")
+		}
+	}
+
+	s := &forStmt{name: p.ident(), line: line}
+	p.expect("in")
+
+	switch {
+	case p.accept("["):
+		s.start = p.expr()
+		p.expect(":")
+		s.end = p.expr()
+		if p.accept(":") {
+			s.step, s.end = s.end, p.expr()
+		}
+		p.expect("]")
+	case p.accept("{"):
+		s.set = p.exprs()
+		p.expect("}")
+	default:
+		p.errorf("expected range or set, found %v", p.peek())
+	}
+
+	s.body = p.body()
+	return s
+}
+
+func (p *parser) gate(line int) stmt {
+	g := &gateDecl{name: p.ident(), line: line}
+	if p.accept("(") {
+		if !p.accept(")") {
+			g.params = p.idents()
+			p.expect(")")
+		}
+	}
+	g.args = p.idents()
+
+	p.expect("{")
+	for !p.accept("}") {
+		if p.peek().kind == eof {
+			p.errorf("expected %q, found %v", "}", p.peek())
+		}
+		g.body = append(g.body, p.operation())
+	}
+
+	return g
+}
+
+func (p *parser) idents() []string {
+	list := []string{p.ident()}
+	for p.accept(",") {
+		list = append(list, p.ident())
+	}
+	return list
+}
+
+func (p *parser) arg() arg {
+	a := arg{name: p.ident()}
+	if p.accept("[") {
+		a.index = p.expr()
+		p.expect("]")
+	}
+	return a
+}
+
+func (p *parser) args() []arg {
+	list := []arg{p.arg()}
+	for p.accept(",") {
+		list = append(list, p.arg())
+	}
+	return list
+}
+
+func (p *parser) exprs() []expr {
+	list := []expr{p.expr()}
+	for p.accept(",") {
+		list = append(list, p.expr())
+	}
+	return list
+}
+
+// expr parses an expression. The precedence from the lowest is
+// ||, &&, comparisons, + -, * / %, unary - and !, ^ and **.
+// Booleans are the numbers 0 and 1.
+func (p *parser) expr() expr {
+	x := p.and()
+	for p.accept("||") {
+		x = &binary{"||", x, p.and()}
+	}
+	return x
+}
+
+func (p *parser) and() expr {
+	x := p.comparison()
+	for p.accept("&&") {
+		x = &binary{"&&", x, p.comparison()}
+	}
+	return x
+}
+
+func (p *parser) comparison() expr {
+	x := p.sum()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			return &binary{op, x, p.sum()}
+		}
+	}
+	return x
+}
+
+func (p *parser) sum() expr {
+	x := p.term()
+	for {
+		switch {
+		case p.accept("+"):
+			x = &binary{"+", x, p.term()}
+		case p.accept("-"):
+			x = &binary{"-", x, p.term()}
+		default:
+			return x
+		}
+	}
+}
+
+func (p *parser) term() expr {
+	x := p.unary()
+	for {
+		switch {
+		case p.accept("*"):
+			x = &binary{"*", x, p.unary()}
+		case p.accept("/"):
+			x = &binary{"/", x, p.unary()}
+		case p.accept("%"):
+			x = &binary{"%", x, p.unary()}
+		default:
+			return x
+		}
+	}
+}
+
+func (p *parser) unary() expr {
+	if p.accept("-") {
+		return &unary{"-", p.unary()}
+	}
+
+	if p.accept("!") {
+		return &unary{"!", p.unary()}
+	}
+
+	if p.accept("+") {
+		return p.unary()
+	}
+
+	return p.power()
+}
+
+func (p *parser) power() expr {
+	x := p.primary()
+	if p.accept("^") || p.accept("**") {
+		return &binary{"^", x, p.unary()}
+	}
+	return x
+}
+
+func (p *parser) primary() expr {
+	t := p.next()
+	switch t.kind {
+	case number:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			p.errorf("invalid number %v", t)
+		}
+		return num(v)
+	case ident:
+		if _, ok := functions[t.text]; ok && p.accept("(") {
+			x := p.expr()
+			p.expect(")")
+			return &call{t.text, x}
+		}
+		if p.accept("[") {
+			i := p.expr()
+			p.expect("]")
+			return &index{t.text, i}
+		}
+		switch t.text {
+		case "true":
+			return num(1)
+		case "false":
+			return num(0)
+		}
+		return name(t.text)
+	}
+
+	if t.text == "(" && t.kind == symbol {
+		x := p.expr()
+		p.expect(")")
+		return x
+	}
+
+	p.errorf("unexpected %v", t)
+	return nil
+}
+
+var functions = map[string]func(float64) float64{
+	"sin":  math.Sin,
+	"cos":  math.Cos,
+	"tan":  math.Tan,
+	"exp":  math.Exp,
+	"ln":   math.Log,
+	"sqrt": math.Sqrt,
+}
+
+// lookup returns the value of the variable, or of its bit if i is not negative.
+type lookup func(name string, i int) (float64, error)
+
+// values returns the lookup of the parameters of a gate.
+func values(env map[string]float64) lookup {
+	return func(n string, i int) (float64, error) {
+		if v, ok := env[n]; ok && i < 0 {
+			return v, nil
+		}
+		return 0, fmt.Errorf("undefined parameter %q", n)
+	}
+}
+
+// eval evaluates the expression with the values of the variables.
+func eval(e expr, env lookup) (float64, error) {
+	if env == nil {
+		env = values(nil)
+	}
+
+	switch e := e.(type) {
+	case num:
+		return float64(e), nil
+	case name:
+		v, err := env(string(e), -1)
+		if err != nil && e == "pi" {
+			return math.Pi, nil
+		}
+		return v, err
+	case *index:
+		i, err := integer(e.i, env)
+		if err != nil {
+			return 0, err
+		}
+		return env(e.name, i)
+	case *unary:
+		x, err := eval(e.x, env)
+		if e.op == "!" {
+			return truth(x == 0), err
+		}
+		return -x, err
+	case *call:
+		x, err := eval(e.x, env)
+		return functions[e.fn](x), err
+	case *binary:
+		x, err := eval(e.x, env)
+		if err != nil {
+			return 0, err
+		}
+		y, err := eval(e.y, env)
+		if err != nil {
+			return 0, err
+		}
+
+		switch e.op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			return x / y, nil
+		case "%":
+			return math.Mod(x, y), nil
+		case "^":
+			return math.Pow(x, y), nil
+		case "==":
+			return truth(x == y), nil
+		case "!=":
+			return truth(x != y), nil
+		case "<":
+			return truth(x < y), nil
+		case ">":
+			return truth(x > y), nil
+		case "<=":
+			return truth(x <= y), nil
+		case ">=":
+			return truth(x >= y), nil
+		case "&&":
+			return truth(x != 0 && y != 0), nil
+		case "||":
+			return truth(x != 0 || y != 0), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid expression %v", e)
+}
+
+// integer evaluates the expression that must be an integer.
+func integer(e expr, env lookup) (int, error) {
+	v, err := eval(e, env)
+	if err != nil {
+		return 0, err
+	}
+
+	if v != math.Trunc(v) {
+		return 0, fmt.Errorf("%v is not an integer", v)
+	}
+
+	return int(v), nil
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,438 @@
+package qasm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/axamon/q"
+)
+
+// MaxIterations is the number of iterations after which a while loop fails.
+var MaxIterations = 1 << 20
+
+var (
+	errBreak    = errors.New("break")
+	errContinue = errors.New("continue")
+)
+
+// Program is an OpenQASM 2.0 or 3 program.
+type Program struct {
+	prog *program
+}
+
+// Compile parses the OpenQASM source. Unlike Parse, it accepts the classical
+// variables and control flow of OpenQASM 3, which are evaluated when the
+// program runs: typed bits, int, uint, float, angle and bool variables,
+// assignments, if and else, while and for loops, break and continue,
+// reset and the gate modifiers ctrl, negctrl, inv and pow.
+func Compile(src string) (*Program, error) {
+	prog, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := supported(prog.version); err != nil {
+		return nil, err
+	}
+
+	return &Program{prog}, nil
+}
+
+// Run executes the program on the simulator and returns the values
+// of the classical registers and of the variables. Qubits are added
+// to the simulator when they are declared.
+// Like ConditionX, the circuit of the simulator records the gates
+// the control flow applied, not the control flow itself.
+func (p *Program) Run(qsim *q.Q) (map[string]float64, error) {
+	m := &machine{
+		qsim:  qsim,
+		qreg:  map[string][]int{},
+		creg:  map[string][]int{},
+		vars:  map[string]*variable{},
+		gates: gates{},
+		clbit: map[int]int{},
+		next:  len(qsim.Clbits()),
+	}
+
+	for _, s := range p.prog.stmts {
+		if err := m.stmt(s); err != nil {
+			if err == errBreak || err == errContinue {
+				return nil, fmt.Errorf("qasm: %v outside of a loop", err)
+			}
+			return nil, err
+		}
+	}
+
+	out := map[string]float64{}
+	for n := range m.creg {
+		out[n], _ = m.lookup(n, -1)
+	}
+	for n, v := range m.vars {
+		out[n] = v.value
+	}
+
+	return out, nil
+}
+
+// variable is a classical variable other than bit.
+type variable struct {
+	typ   string
+	value float64
+}
+
+// set stores the value converted to the type of the variable.
+func (v *variable) set(value float64) {
+	switch v.typ {
+	case "int", "uint":
+		value = math.Trunc(value)
+	case "bool":
+		value = truth(value != 0)
+	}
+
+	v.value = value
+}
+
+// machine executes the statements on the simulator.
+type machine struct {
+	qsim  *q.Q
+	qreg  map[string][]int
+	creg  map[string][]int
+	vars  map[string]*variable
+	gates gates
+
+	// clbit are the values of the classical bits of the registers.
+	clbit map[int]int
+
+	// next is the index of the next classical bit of the simulator.
+	next int
+}
+
+func (m *machine) stmt(s stmt) error {
+	switch s := s.(type) {
+	case block:
+		return m.block(s)
+	case *regDecl:
+		if err := m.register(s); err != nil {
+			return err
+		}
+		if s.init != nil {
+			return m.assign(s.init)
+		}
+	case *varDecl:
+		if err := m.declare(s.name, s.line); err != nil {
+			return err
+		}
+		v := &variable{typ: s.typ}
+		if s.init != nil {
+			x, err := m.eval(s.init, s.line)
+			if err != nil {
+				return err
+			}
+			v.set(x)
+		}
+		m.vars[s.name] = v
+	case *gateDecl:
+		return m.gates.declare(s)
+	case *assignStmt:
+		return m.assign(s)
+	case *ifStmt:
+		c, err := m.eval(s.cond, s.line)
+		if err != nil {
+			return err
+		}
+		if c != 0 {
+			return m.stmt(s.then)
+		}
+		if s.els != nil {
+			return m.stmt(s.els)
+		}
+	case *whileStmt:
+		for i := 0; ; i++ {
+			if i == MaxIterations {
+				return fmt.Errorf("line %d: while: more than %d iterations", s.line, MaxIterations)
+			}
+
+			c, err := m.eval(s.cond, s.line)
+			if err != nil {
+				return err
+			}
+			if c == 0 {
+				break
+			}
+
+			if err := m.stmt(s.body); err == errBreak {
+				break
+			} else if err != nil && err != errContinue {
+				return err
+			}
+		}
+	case *forStmt:
+		return m.loop(s)
+	case *breakStmt:
+		return errBreak
+	case *continueStmt:
+		return errContinue
+	case *measureStmt:
+		return m.measure(s.q, s.c, s.line)
+	case *resetStmt:
+		b, err := resolve(m.qreg, s.q, m.lookup, s.line)
+		if err != nil {
+			return err
+		}
+		return m.qsim.Exec(q.Instruction{Name: "reset", Target: b})
+	case *barrierStmt:
+		in := q.Instruction{Name: "barrier"}
+		for _, a := range s.args {
+			b, err := resolve(m.qreg, a, m.lookup, s.line)
+			if err != nil {
+				return err
+			}
+			in.Target = append(in.Target, b...)
+		}
+		return m.qsim.Exec(in)
+	case *gateCall:
+		list, err := m.gates.call(s, m.qreg, m.lookup)
+		if err != nil {
+			return err
+		}
+		if err := m.qsim.Exec(list...); err != nil {
+			return fmt.Errorf("line %d: %w", s.line, err)
+		}
+	default:
+		return fmt.Errorf("qasm: unexpected statement %T", s)
+	}
+
+	return nil
+}
+
+// block executes the statements and then forgets the variables they declared.
+func (m *machine) block(b block) error {
+	vars, creg := map[string]bool{}, map[string]bool{}
+	for n := range m.vars {
+		vars[n] = true
+	}
+	for n := range m.creg {
+		creg[n] = true
+	}
+
+	defer func() {
+		for n := range m.vars {
+			if !vars[n] {
+				delete(m.vars, n)
+			}
+		}
+		for n := range m.creg {
+			if !creg[n] {
+				delete(m.creg, n)
+			}
+		}
+	}()
+
+	for _, s := range b {
+		if err := m.stmt(s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// declare returns an error if the name is already declared.
+func (m *machine) declare(n string, line int) error {
+	_, qok := m.qreg[n]
+	_, cok := m.creg[n]
+	_, vok := m.vars[n]
+	if qok || cok || vok {
+		return fmt.Errorf("line %d: %q is already declared", line, n)
+	}
+
+	return nil
+}
+
+func (m *machine) register(r *regDecl) error {
+	if err := m.declare(r.name, r.line); err != nil {
+		return err
+	}
+
+	// the simulator adds no qubits after an error
+	if err := m.qsim.Err(); err != nil && r.quantum {
+		return fmt.Errorf("line %d: %w", r.line, err)
+	}
+
+	bits := []int{}
+	for i := 0; i < r.size; i++ {
+		if r.quantum {
+			bits = append(bits, m.qsim.Zero().Index)
+			continue
+		}
+
+		bits = append(bits, m.next)
+		m.next++
+	}
+
+	if r.quantum {
+		m.qreg[r.name] = bits
+		return nil
+	}
+
+	m.creg[r.name] = bits
+	return nil
+}
+
+// lookup returns the value of the variable or of the classical register.
+// Register values have the bit 0 as the least significant bit.
+func (m *machine) lookup(n string, i int) (float64, error) {
+	if v, ok := m.vars[n]; ok && i < 0 {
+		return v.value, nil
+	}
+
+	bits, ok := m.creg[n]
+	if !ok {
+		return 0, fmt.Errorf("undefined variable %q", n)
+	}
+
+	if i >= len(bits) {
+		return 0, fmt.Errorf("index %d out of range of %q", i, n)
+	}
+
+	if i > -1 {
+		return float64(m.clbit[bits[i]]), nil
+	}
+
+	v := 0
+	for j, b := range bits {
+		v = v | m.clbit[b]<<uint(j)
+	}
+
+	return float64(v), nil
+}
+
+func (m *machine) eval(e expr, line int) (float64, error) {
+	v, err := eval(e, m.lookup)
+	if err != nil {
+		return 0, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	return v, nil
+}
+
+func (m *machine) assign(s *assignStmt) error {
+	if s.measure {
+		return m.measure(s.q, s.target, s.line)
+	}
+
+	x, err := m.eval(s.value, s.line)
+	if err != nil {
+		return err
+	}
+
+	if v, ok := m.vars[s.target.name]; ok && s.target.index == nil {
+		switch s.op {
+		case "+=":
+			x = v.value + x
+		case "-=":
+			x = v.value - x
+		case "*=":
+			x = v.value * x
+		case "/=":
+			x = v.value / x
+		}
+		v.set(x)
+		return nil
+	}
+
+	if s.op != "=" {
+		return fmt.Errorf("line %d: %s on classical bits: %w", s.line, s.op, ErrNotSupported)
+	}
+
+	bits, err := resolve(m.creg, s.target, m.lookup, s.line)
+	if err != nil {
+		return err
+	}
+
+	for i, b := range bits {
+		m.clbit[b] = int(x) >> uint(i) & 1
+	}
+
+	return nil
+}
+
+// measure measures the qubits into the classical bits.
+func (m *machine) measure(qa, ca arg, line int) error {
+	qb, err := resolve(m.qreg, qa, m.lookup, line)
+	if err != nil {
+		return err
+	}
+	cb, err := resolve(m.creg, ca, m.lookup, line)
+	if err != nil {
+		return err
+	}
+	if len(qb) != len(cb) {
+		return fmt.Errorf("line %d: registers of different size", line)
+	}
+
+	for i := range qb {
+		if err := m.qsim.Exec(q.Instruction{Name: "measure", Target: []int{qb[i]}, Clbit: []int{cb[i]}}); err != nil {
+			return err
+		}
+		m.clbit[cb[i]] = m.qsim.Clbits()[cb[i]]
+	}
+
+	return nil
+}
+
+// loop executes the body of the for loop. The variable
+// is visible only in the body.
+func (m *machine) loop(s *forStmt) error {
+	list := []float64{}
+	if s.set != nil {
+		for _, e := range s.set {
+			v, err := m.eval(e, s.line)
+			if err != nil {
+				return err
+			}
+			list = append(list, v)
+		}
+	} else {
+		start, err := m.eval(s.start, s.line)
+		if err != nil {
+			return err
+		}
+		end, err := m.eval(s.end, s.line)
+		if err != nil {
+			return err
+		}
+		step := 1.0
+		if s.step != nil {
+			if step, err = m.eval(s.step, s.line); err != nil {
+				return err
+			}
+		}
+		if step == 0 {
+			return fmt.Errorf("line %d: for: step is zero", s.line)
+		}
+
+		// the end of a range is included
+		for v := start; step > 0 && v <= end || step < 0 && v >= end; v = v + step {
+			list = append(list, v)
+		}
+	}
+
+	if err := m.declare(s.name, s.line); err != nil {
+		return err
+	}
+	defer delete(m.vars, s.name)
+
+	for _, v := range list {
+		m.vars[s.name] = &variable{typ: "int", value: v}
+
+		if err := m.stmt(s.body); err == errBreak {
+			break
+		} else if err != nil && err != errContinue {
+			return err
+		}
+	}
+
+	return nil
+}
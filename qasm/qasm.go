@@ -0,0 +1,569 @@
+// Package qasm reads and writes circuits in OpenQASM 2.0
+// and runs programs in a subset of OpenQASM 3.
+package qasm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"github.com/axamon/q"
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+)
+
+// ErrNotSupported is returned when the operation has no OpenQASM form.
+var ErrNotSupported = errors.New("qasm: not supported")
+
+// builtin is a gate of qelib1.inc.
+type builtin struct {
+	// name is the name of the instruction. It is empty for the identity.
+	name    string
+	params  int
+	control int
+	target  int
+
+	// matrix returns the matrix of the gates the circuit does not know by name.
+	matrix func(p []float64) matrix.Matrix
+}
+
+var builtins = map[string]builtin{
+	"U":     {"u3", 3, 0, 1, nil},
+	"CX":    {"x", 0, 1, 1, nil},
+	"u3":    {"u3", 3, 0, 1, nil},
+	"u2":    {"u2", 2, 0, 1, u2},
+	"u1":    {"p", 1, 0, 1, nil},
+	"cx":    {"x", 0, 1, 1, nil},
+	"id":    {"", 0, 0, 1, nil},
+	"x":     {"x", 0, 0, 1, nil},
+	"y":     {"y", 0, 0, 1, nil},
+	"z":     {"z", 0, 0, 1, nil},
+	"h":     {"h", 0, 0, 1, nil},
+	"s":     {"s", 0, 0, 1, nil},
+	"sdg":   {"sdg", 0, 0, 1, nil},
+	"t":     {"t", 0, 0, 1, nil},
+	"tdg":   {"tdg", 0, 0, 1, nil},
+	"rx":    {"rx", 1, 0, 1, nil},
+	"ry":    {"ry", 1, 0, 1, nil},
+	"rz":    {"rz", 1, 0, 1, nil},
+	"cz":    {"z", 0, 1, 1, nil},
+	"cy":    {"y", 0, 1, 1, nil},
+	"ch":    {"h", 0, 1, 1, nil},
+	"ccx":   {"x", 0, 2, 1, nil},
+	"crz":   {"rz", 1, 1, 1, nil},
+	"cu1":   {"p", 1, 1, 1, nil},
+	"cu3":   {"u3", 3, 1, 1, nil},
+	"swap":  {"swap", 0, 0, 2, nil},
+	"cswap": {"swap", 0, 1, 2, nil},
+
+	// stdgates.inc of OpenQASM 3
+	"p":      {"p", 1, 0, 1, nil},
+	"phase":  {"p", 1, 0, 1, nil},
+	"cp":     {"p", 1, 1, 1, nil},
+	"cphase": {"p", 1, 1, 1, nil},
+	"sx":     {"sx", 0, 0, 1, sx},
+	"crx":    {"rx", 1, 1, 1, nil},
+	"cry":    {"ry", 1, 1, 1, nil},
+	"cu":     {"cu", 4, 1, 1, cu},
+}
+
+// names are the qelib1.inc names of the instructions by number of controls.
+var names = map[string][]string{
+	"x":    {"x", "cx", "ccx"},
+	"y":    {"y", "cy"},
+	"z":    {"z", "cz"},
+	"h":    {"h", "ch"},
+	"s":    {"s"},
+	"sdg":  {"sdg"},
+	"t":    {"t"},
+	"tdg":  {"tdg"},
+	"p":    {"u1", "cu1"},
+	"u2":   {"u2"},
+	"u3":   {"u3", "cu3"},
+	"rx":   {"rx"},
+	"ry":   {"ry"},
+	"rz":   {"rz", "crz"},
+	"swap": {"swap", "cswap"},
+}
+
+func u2(p []float64) matrix.Matrix {
+	return gate.U3(math.Pi/2, p[0], p[1])
+}
+
+func sx(p []float64) matrix.Matrix {
+	return matrix.New(
+		[]complex128{complex(0.5, 0.5), complex(0.5, -0.5)},
+		[]complex128{complex(0.5, -0.5), complex(0.5, 0.5)},
+	)
+}
+
+// cu is u3 with the global phase gamma, which is observable when controlled.
+func cu(p []float64) matrix.Matrix {
+	return gate.U3(p[0], p[1], p[2]).Mul(cmplx.Exp(complex(0, p[3])))
+}
+
+// Parse returns the circuit of the OpenQASM 2.0 source, or of an OpenQASM 3
+// source without classical control flow. Quantum registers are laid out in
+// order of declaration on one register, classical registers become the
+// registers of the circuit. The conditions of if must compare a classical
+// register with a value. Use Compile to run the other programs.
+func Parse(src string) (*q.Circuit, error) {
+	prog, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := supported(prog.version); err != nil {
+		return nil, err
+	}
+
+	l := &lowering{
+		circuit: &q.Circuit{},
+		qreg:    map[string][]int{},
+		creg:    map[string][]int{},
+		gates:   gates{},
+	}
+
+	for _, s := range prog.stmts {
+		if err := l.stmt(s, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return l.circuit, nil
+}
+
+func supported(version string) error {
+	switch version {
+	case "2", "2.0", "3", "3.0":
+		return nil
+	}
+
+	return fmt.Errorf("qasm: version %s is not supported", version)
+}
+
+// lowering turns the statements into the instructions of the circuit.
+type lowering struct {
+	circuit *q.Circuit
+	qreg    map[string][]int
+	creg    map[string][]int
+	gates   gates
+}
+
+func (l *lowering) stmt(s stmt, cond *q.Condition) error {
+	switch s := s.(type) {
+	case block:
+		for _, b := range s {
+			if err := l.stmt(b, cond); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *regDecl:
+		if err := l.register(s); err != nil {
+			return err
+		}
+		if s.init != nil {
+			return l.stmt(s.init, cond)
+		}
+		return nil
+	case *gateDecl:
+		return l.gates.declare(s)
+	case *ifStmt:
+		if cond != nil || s.els != nil {
+			return fmt.Errorf("line %d: nested if and else: %w", s.line, ErrNotSupported)
+		}
+		c, err := l.condition(s.cond, s.line)
+		if err != nil {
+			return err
+		}
+		return l.stmt(s.then, c)
+	case *measureStmt:
+		return l.measure(s.q, s.c, cond, s.line)
+	case *assignStmt:
+		if !s.measure {
+			return fmt.Errorf("line %d: assignment: %w", s.line, ErrNotSupported)
+		}
+		return l.measure(s.q, s.target, cond, s.line)
+	case *resetStmt:
+		bits, err := l.bits(l.qreg, s.q, s.line)
+		if err != nil {
+			return err
+		}
+		l.append(q.Instruction{Name: "reset", Target: bits}, cond)
+		return nil
+	case *barrierStmt:
+		in := q.Instruction{Name: "barrier"}
+		for _, a := range s.args {
+			bits, err := l.bits(l.qreg, a, s.line)
+			if err != nil {
+				return err
+			}
+			in.Target = append(in.Target, bits...)
+		}
+		l.append(in, cond)
+		return nil
+	case *gateCall:
+		return l.call(s, cond)
+	case *varDecl:
+		return fmt.Errorf("line %d: variable %q: %w", s.line, s.name, ErrNotSupported)
+	case *whileStmt:
+		return fmt.Errorf("line %d: while: %w", s.line, ErrNotSupported)
+	case *forStmt:
+		return fmt.Errorf("line %d: for: %w", s.line, ErrNotSupported)
+	case *breakStmt:
+		return fmt.Errorf("line %d: break: %w", s.line, ErrNotSupported)
+	case *continueStmt:
+		return fmt.Errorf("line %d: continue: %w", s.line, ErrNotSupported)
+	}
+
+	return fmt.Errorf("qasm: unexpected statement %T", s)
+}
+
+func (l *lowering) register(r *regDecl) error {
+	if _, ok := l.qreg[r.name]; ok {
+		return fmt.Errorf("line %d: register %q is already declared", r.line, r.name)
+	}
+	if _, ok := l.creg[r.name]; ok {
+		return fmt.Errorf("line %d: register %q is already declared", r.line, r.name)
+	}
+
+	bits := []int{}
+	if r.quantum {
+		for i := 0; i < r.size; i++ {
+			bits = append(bits, l.circuit.NumberOfBit())
+			l.circuit.Init = append(l.circuit.Init, nil)
+		}
+		l.qreg[r.name] = bits
+		return nil
+	}
+
+	for i := 0; i < r.size; i++ {
+		bits = append(bits, l.circuit.Clbits)
+		l.circuit.Clbits++
+	}
+	l.creg[r.name] = bits
+	l.circuit.Registers = append(l.circuit.Registers, q.Register{Name: r.name, Clbit: bits})
+	return nil
+}
+
+// condition returns the condition of "creg == value" or "creg[i] == value".
+func (l *lowering) condition(e expr, line int) (*q.Condition, error) {
+	b, ok := e.(*binary)
+	if !ok || b.op != "==" {
+		return nil, fmt.Errorf("line %d: condition: %w", line, ErrNotSupported)
+	}
+
+	value, err := integer(b.y, nil)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	a := arg{}
+	switch x := b.x.(type) {
+	case name:
+		a.name = string(x)
+	case *index:
+		a.name, a.index = x.name, x.i
+	default:
+		return nil, fmt.Errorf("line %d: condition: %w", line, ErrNotSupported)
+	}
+
+	bits, err := l.bits(l.creg, a, line)
+	if err != nil {
+		return nil, err
+	}
+
+	return &q.Condition{Clbit: bits, Value: value}, nil
+}
+
+func (l *lowering) measure(qa, ca arg, cond *q.Condition, line int) error {
+	qb, err := l.bits(l.qreg, qa, line)
+	if err != nil {
+		return err
+	}
+	cb, err := l.bits(l.creg, ca, line)
+	if err != nil {
+		return err
+	}
+	if len(qb) != len(cb) {
+		return fmt.Errorf("line %d: registers of different size", line)
+	}
+
+	for i := range qb {
+		l.append(q.Instruction{Name: "measure", Target: []int{qb[i]}, Clbit: []int{cb[i]}}, cond)
+	}
+	return nil
+}
+
+// bits returns the bits of the argument.
+func (l *lowering) bits(reg map[string][]int, a arg, line int) ([]int, error) {
+	return resolve(reg, a, nil, line)
+}
+
+// call applies the gate broadcasting it over the registers of the arguments.
+func (l *lowering) call(g *gateCall, cond *q.Condition) error {
+	list, err := l.gates.call(g, l.qreg, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, in := range list {
+		l.append(in, cond)
+	}
+
+	return nil
+}
+
+func (l *lowering) append(in q.Instruction, cond *q.Condition) {
+	in.Condition = cond
+	l.circuit.Append(in)
+}
+
+// resolve returns the bits of the argument in the register.
+// The index is evaluated with the variables of env.
+func resolve(reg map[string][]int, a arg, env lookup, line int) ([]int, error) {
+	bits, ok := reg[a.name]
+	if !ok {
+		return nil, fmt.Errorf("line %d: undefined register %q", line, a.name)
+	}
+
+	if a.index == nil {
+		return bits, nil
+	}
+
+	i, err := integer(a.index, env)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	if i < 0 || i >= len(bits) {
+		return nil, fmt.Errorf("line %d: index %d out of range of %q", line, i, a.name)
+	}
+
+	return []int{bits[i]}, nil
+}
+
+// gates are the gates defined by the program.
+type gates map[string]*gateDecl
+
+// declare adds the gate. The gates of its body must be builtin or declared
+// before it, as in OpenQASM 2, so that a gate cannot call itself.
+func (g gates) declare(d *gateDecl) error {
+	if _, ok := g[d.name]; ok {
+		return fmt.Errorf("line %d: gate %q is already declared", d.line, d.name)
+	}
+
+	for _, s := range d.body {
+		c, ok := s.(*gateCall)
+		if !ok {
+			continue
+		}
+
+		if _, ok := builtins[c.name]; ok {
+			continue
+		}
+
+		if _, ok := g[c.name]; !ok {
+			return fmt.Errorf("line %d: undefined gate %q in %q", c.line, c.name, d.name)
+		}
+	}
+
+	g[d.name] = d
+	return nil
+}
+
+// call returns the instructions of the gate broadcast over the registers
+// of the arguments. The parameters are evaluated with the variables of env.
+func (g gates) call(c *gateCall, reg map[string][]int, env lookup) ([]q.Instruction, error) {
+	params := []float64{}
+	for _, e := range c.params {
+		v, err := eval(e, env)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", c.line, err)
+		}
+		params = append(params, v)
+	}
+
+	args := [][]int{}
+	size := 1
+	for _, a := range c.args {
+		b, err := resolve(reg, a, env, c.line)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > 1 {
+			if size > 1 && size != len(b) {
+				return nil, fmt.Errorf("line %d: registers of different size", c.line)
+			}
+			size = len(b)
+		}
+		args = append(args, b)
+	}
+
+	list := []q.Instruction{}
+	for i := 0; i < size; i++ {
+		b := []int{}
+		for _, a := range args {
+			if len(a) == 1 {
+				b = append(b, a[0])
+				continue
+			}
+			b = append(b, a[i])
+		}
+
+		in, err := g.modify(c.mods, c.name, params, b, env, c.line)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, in...)
+	}
+
+	return list, nil
+}
+
+// modify returns the instructions of the gate with the modifiers.
+// The first bits are the controls of ctrl and negctrl.
+func (g gates) modify(mods []modifier, name string, params []float64, bits []int, env lookup, line int) ([]q.Instruction, error) {
+	if len(mods) == 0 {
+		return g.gate(name, params, bits, line)
+	}
+
+	m := mods[0]
+	n := 1
+	if m.arg != nil {
+		v, err := integer(m.arg, env)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %w", line, m.kind, err)
+		}
+		n = v
+	}
+
+	switch m.kind {
+	case "ctrl", "negctrl":
+		if n < 1 || n > len(bits) {
+			return nil, fmt.Errorf("line %d: wrong number of qubits of %q", line, name)
+		}
+
+		list, err := g.modify(mods[1:], name, params, bits[n:], env, line)
+		if err != nil {
+			return nil, err
+		}
+
+		control := bits[:n]
+		for i := range list {
+			if list[i].Name == "barrier" {
+				continue
+			}
+			if m.kind == "negctrl" {
+				list[i].Open = append(append([]int{}, control...), list[i].Open...)
+				continue
+			}
+			list[i].Control = append(append([]int{}, control...), list[i].Control...)
+		}
+
+		return list, nil
+	case "inv", "pow":
+		list, err := g.modify(mods[1:], name, params, bits, env, line)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.kind == "inv" {
+			n = -1
+		}
+
+		if n < 0 {
+			inv := []q.Instruction{}
+			for i := len(list) - 1; i > -1; i-- {
+				in, err := list[i].Inverse()
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				inv = append(inv, in)
+			}
+			list, n = inv, -n
+		}
+
+		pow := []q.Instruction{}
+		for i := 0; i < n; i++ {
+			pow = append(pow, list...)
+		}
+		return pow, nil
+	}
+
+	return nil, fmt.Errorf("line %d: modifier %q: %w", line, m.kind, ErrNotSupported)
+}
+
+// gate returns the instructions of the builtin or defined gate on the bits.
+func (g gates) gate(name string, params []float64, bits []int, line int) ([]q.Instruction, error) {
+	if b, ok := builtins[name]; ok {
+		if len(params) != b.params || len(bits) != b.control+b.target {
+			return nil, fmt.Errorf("line %d: wrong number of parameters or qubits of %q", line, name)
+		}
+
+		if b.name == "" {
+			return nil, nil
+		}
+
+		in := q.Instruction{
+			Name:    b.name,
+			Control: bits[:b.control],
+			Target:  bits[b.control:],
+		}
+		if b.params > 0 {
+			in.Params = params
+		}
+		if b.matrix != nil {
+			in.Matrix = b.matrix(params)
+		}
+
+		return []q.Instruction{in}, nil
+	}
+
+	d, ok := g[name]
+	if !ok {
+		return nil, fmt.Errorf("line %d: undefined gate %q", line, name)
+	}
+
+	if len(params) != len(d.params) || len(bits) != len(d.args) {
+		return nil, fmt.Errorf("line %d: wrong number of parameters or qubits of %q", line, name)
+	}
+
+	env := map[string]float64{}
+	for i, p := range d.params {
+		env[p] = params[i]
+	}
+
+	local := map[string][]int{}
+	for i, a := range d.args {
+		local[a] = []int{bits[i]}
+	}
+
+	list := []q.Instruction{}
+	for _, s := range d.body {
+		switch s := s.(type) {
+		case *barrierStmt:
+			in := q.Instruction{Name: "barrier"}
+			for _, a := range s.args {
+				b, err := resolve(local, a, nil, line)
+				if err != nil {
+					return nil, err
+				}
+				in.Target = append(in.Target, b...)
+			}
+			list = append(list, in)
+		case *gateCall:
+			in, err := g.call(s, local, values(env))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, in...)
+		default:
+			return nil, fmt.Errorf("line %d: only gates are allowed in %q", line, name)
+		}
+	}
+
+	return list, nil
+}
@@ -0,0 +1,518 @@
+package qasm_test
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+
+	"github.com/axamon/q"
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/noise"
+	"github.com/axamon/q/qasm"
+)
+
+const teleportation = `OPENQASM 2.0;
+include "qelib1.inc";
+qreg q[3];
+creg c0[1];
+creg c1[1];
+h q[1];
+cx q[1],q[2];
+cx q[0],q[1];
+h q[0];
+measure q[0] -> c0[0];
+measure q[1] -> c1[0];
+if(c0==1) z q[2];
+if(c1==1) x q[2];
+`
+
+func grover() *q.Q {
+	qsim := q.New()
+
+	q0 := qsim.Zero()
+	q1 := qsim.Zero()
+	q2 := qsim.Zero()
+	q3 := qsim.One()
+
+	qsim.H(q0, q1, q2, q3)
+
+	// oracle
+	qsim.X(q0).ControlledNot([]*q.Qubit{q0, q1, q2}, q3).X(q0)
+
+	// amp
+	qsim.H(q0, q1, q2, q3)
+	qsim.X(q0, q1, q2)
+	qsim.ControlledZ([]*q.Qubit{q0, q1}, q2)
+	qsim.H(q0, q1, q2)
+
+	return qsim
+}
+
+func TestGroverRoundTrip(t *testing.T) {
+	qsim := grover()
+
+	src, err := qasm.Export(qsim.Circuit())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(src, "x q[0];\nu1(0.7853981633974483) q[2];\ncu3(") {
+		t.Error(src)
+	}
+
+	c, err := qasm.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := q.New()
+	if err := replay.Run(c); err != nil {
+		t.Fatal(err)
+	}
+
+	p, e := replay.Probability(), qsim.Probability()
+	for i := range p {
+		if math.Abs(p[i]-e[i]) > 1e-13 {
+			t.Errorf("%v: %v\n", p, e)
+		}
+	}
+
+	src2, err := qasm.Export(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if src != src2 {
+		t.Errorf("%v: %v\n", src, src2)
+	}
+}
+
+func TestTeleportationRoundTrip(t *testing.T) {
+	c, err := qasm.Parse(teleportation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.NumberOfBit() != 3 || c.Clbits != 2 || len(c.Registers) != 2 {
+		t.Error(c)
+	}
+
+	src, err := qasm.Export(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if src != teleportation {
+		t.Errorf("%v: %v\n", src, teleportation)
+	}
+
+	for i := 0; i < 10; i++ {
+		qsim := q.New()
+		qsim.New(1, 2)
+
+		if err := qsim.Run(c); err != nil {
+			t.Fatal(err)
+		}
+
+		m := qsim.Clbits()
+		k := m[0]*4 + m[1]*2
+		p := qsim.Probability()
+		if math.Abs(p[k]-0.2) > 1e-13 || math.Abs(p[k+1]-0.8) > 1e-13 {
+			t.Errorf("%v: %v\n", m, p)
+		}
+	}
+}
+
+func TestExportInit(t *testing.T) {
+	qsim := q.New()
+	q0 := qsim.New(1, 2)
+	q1 := qsim.One()
+	qsim.Zero()
+	qsim.CNOT(q0, q1).QFT()
+
+	src, err := qasm.Export(qsim.Circuit())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := qasm.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := q.New()
+	if err := replay.Run(c); err != nil {
+		t.Fatal(err)
+	}
+
+	p, e := replay.Probability(), qsim.Probability()
+	for i := range p {
+		if math.Abs(p[i]-e[i]) > 1e-13 {
+			t.Errorf("%v: %v\n", p, e)
+		}
+	}
+
+	qsim.ApplyChannel(noise.BitFlip(0.1), q0)
+	if _, err := qasm.Export(qsim.Circuit()); err == nil {
+		t.Error("channel is exported")
+	}
+}
+
+func TestExportInverseQFT(t *testing.T) {
+	qsim := q.New()
+	q0 := qsim.New(1, 2)
+	q1 := qsim.New(3, 1i)
+	q2 := qsim.One()
+	qsim.CNOT(q0, q2).InverseQFT().H(q1).QFT().InverseQFT()
+
+	src, err := qasm.Export(qsim.Circuit())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := qasm.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := q.New()
+	if err := replay.Run(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if !replay.DensityMatrix().Equals(qsim.DensityMatrix(), 1e-13) {
+		t.Errorf("%v: %v\n", replay.Probability(), qsim.Probability())
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	theta, phi, lambda := 0.3, 0.5, 0.7
+	c, err := qasm.Parse(`OPENQASM 2.0;
+qreg q[1];
+u3(0.3,0.5,0.7) q[0];
+U(0.3,0.5,0.7) q[0];
+u2(0.5,0.7) q[0];
+u1(0.7) q[0];
+rx(0.3) q[0];
+ry(0.3) q[0];
+rz(0.3) q[0];
+id q[0];
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c0, s0 := complex(math.Cos(theta/2), 0), complex(math.Sin(theta/2), 0)
+	expected := [][]complex128{
+		{c0, -cmplx.Exp(complex(0, lambda)) * s0, cmplx.Exp(complex(0, phi)) * s0, cmplx.Exp(complex(0, phi+lambda)) * c0},
+		{c0, -cmplx.Exp(complex(0, lambda)) * s0, cmplx.Exp(complex(0, phi)) * s0, cmplx.Exp(complex(0, phi+lambda)) * c0},
+		{complex(1/math.Sqrt2, 0), -cmplx.Exp(complex(0, lambda)) / math.Sqrt2, cmplx.Exp(complex(0, phi)) / math.Sqrt2, cmplx.Exp(complex(0, phi+lambda)) / math.Sqrt2},
+		{1, 0, 0, cmplx.Exp(complex(0, lambda))},
+		{c0, complex(0, -real(s0)), complex(0, -real(s0)), c0},
+		{c0, -s0, s0, c0},
+		{cmplx.Exp(complex(0, -theta/2)), 0, 0, cmplx.Exp(complex(0, theta/2))},
+	}
+
+	if len(c.Instructions) != len(expected) {
+		t.Fatal(c)
+	}
+
+	for i, in := range c.Instructions {
+		u := in.Unitary()
+		e := gate.New(expected[i][:2], expected[i][2:])
+
+		// up to the global phase
+		if !u.Equals(e, 1e-13) && !u.Mul(-1).Equals(e, 1e-13) {
+			t.Errorf("%v: %v %v\n", in, u, e)
+		}
+	}
+}
+
+func TestCustomGate(t *testing.T) {
+	c, err := qasm.Parse(`OPENQASM 2.0;
+include "qelib1.inc";
+// controlled phase rotation
+gate cphase(lambda) a, b {
+  u1(lambda/2) a;
+  cx a, b;
+  u1(-lambda/2) b;
+  cx a, b;
+  u1(lambda/2) b;
+}
+gate bell a, b { h a; cx a, b; }
+qreg q[2];
+qreg r[2];
+bell q[0], r[0];
+x q;
+cphase(pi/2) q, r;
+barrier q, r;
+cswap q[0], r[0], r[1];
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qsim := q.New()
+	if err := qsim.Run(c); err != nil {
+		t.Fatal(err)
+	}
+
+	e := q.New()
+	q0, q1, r0, r1 := e.Zero(), e.Zero(), e.Zero(), e.Zero()
+	e.H(q0).CNOT(q0, r0).X(q0, q1)
+	e.CR(q0, r0, 2).CR(q1, r1, 2)
+	e.ControlledNot([]*q.Qubit{q0, r1}, r0).ControlledNot([]*q.Qubit{q0, r0}, r1).ControlledNot([]*q.Qubit{q0, r1}, r0)
+
+	p0, p1 := qsim.DensityMatrix(), e.DensityMatrix()
+	if !p0.Equals(p1, 1e-13) {
+		t.Errorf("%v: %v\n", p0.Matrix(), p1.Matrix())
+	}
+}
+
+func TestExportUnitary(t *testing.T) {
+	u := gate.U(0.1, 0.2, 0.3, 0.4)
+
+	qsim := q.New()
+	q0 := qsim.New(1, 2)
+	q1 := qsim.New(3, 4)
+	q2 := qsim.New(5, 6)
+	q3 := qsim.New(7, 8)
+
+	qsim.Apply(u, q0)
+	qsim.Apply(gate.S(), q1)
+	qsim.ControlledNot([]*q.Qubit{q0, q1}, q2)
+	qsim.ControlledZ([]*q.Qubit{q0, q1, q2}, q3)
+	qsim.ControlledR([]*q.Qubit{q3, q1}, q0, 3)
+	qsim.Swap(q1, q3)
+
+	src, err := qasm.Export(qsim.Circuit())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := qasm.Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := q.New()
+	if err := replay.Run(c); err != nil {
+		t.Fatal(err)
+	}
+
+	// equal up to the global phase of u
+	p0, p1 := replay.DensityMatrix(), qsim.DensityMatrix()
+	if !p0.Equals(p1, 1e-13) {
+		t.Errorf("%v: %v\n", p0.Matrix(), p1.Matrix())
+	}
+}
+
+func TestParseError(t *testing.T) {
+	var test = []struct {
+		src string
+		err string
+	}{
+		{"OPENQASM 2.0;\nqreg q[1];\nfoo q[0];", "line 3: undefined gate \"foo\""},
+		{"OPENQASM 2.0;\nqreg q[1];\nh q[1];", "line 3: index 1 out of range of \"q\""},
+		{"OPENQASM 2.0;\nqreg q[1];\nh q[0]", "line 3: expected \";\", found end of file"},
+		{"OPENQASM 2.0;\nqreg q[1];\ncx q[0];", "line 3: wrong number of parameters or qubits of \"cx\""},
+		{"OPENQASM 2.0;\nqreg q[2];\ncreg c[1];\nmeasure q -> c;", "line 4: registers of different size"},
+		{"OPENQASM 2.0;\nqreg q[1];\nrx(theta) q[0];", "line 3: undefined parameter \"theta\""},
+		{"OPENQASM 4.0;\nqreg q[1];", "qasm: version 4.0 is not supported"},
+		{"OPENQASM 3;\nbit c;\nwhile (c == 0) c = 1;", "line 3: while: qasm: not supported"},
+		{"OPENQASM 2.0;\nqreg q[1];\n$", "line 3: unexpected '$'"},
+		{"OPENQASM 2.0;\nqreg r[1];\ngate g a { g a; }\ng r[0];", "line 3: undefined gate \"g\" in \"g\""},
+		{"OPENQASM 2.0;\nqreg r[1];\ngate f a { g a; }\ngate g a { f a; }\ng r[0];", "line 3: undefined gate \"g\" in \"f\""},
+		{"OPENQASM 2.0;\nqreg r[1];\ngate g a { h a; }\ngate g a { g a; }", "line 4: gate \"g\" is already declared"},
+	}
+
+	for _, tt := range test {
+		_, err := qasm.Parse(tt.src)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%v: %v\n", err, tt.err)
+		}
+	}
+}
+
+func TestParseErrorIs(t *testing.T) {
+	if _, err := qasm.Parse("OPENQASM 3;\nbit c;\nwhile (c == 0) c = 1;"); !errors.Is(err, qasm.ErrNotSupported) {
+		t.Error(err)
+	}
+
+	c := q.NewCircuit(1).Append(q.Instruction{Name: "rx", Symbols: []q.Param{q.Symbol("theta")}, Target: []int{0}})
+	if _, err := qasm.Export(c); !errors.Is(err, q.ErrUnboundParameter) {
+		t.Error(err)
+	}
+}
+
+func TestCompileTeleportation(t *testing.T) {
+	src := `OPENQASM 3;
+include "stdgates.inc";
+qubit[3] q;
+bit c0;
+bit c1;
+u3(0.7, 0.3, 0) q[0];
+h q[1];
+cx q[1], q[2];
+cx q[0], q[1];
+h q[0];
+c0 = measure q[0];
+c1 = measure q[1];
+if (c0 == 1) z q[2];
+if (c1) {
+  x q[2];
+} else {
+  id q[2];
+}
+`
+
+	prog, err := qasm.Compile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		qsim := q.New()
+		if _, err := prog.Run(qsim); err != nil {
+			t.Fatal(err)
+		}
+
+		p0 := 0.0
+		for j, p := range qsim.Probability() {
+			if j%2 == 0 {
+				p0 = p0 + p
+			}
+		}
+
+		if math.Abs(p0-math.Pow(math.Cos(0.35), 2)) > 1e-13 {
+			t.Errorf("%v", qsim.Probability())
+		}
+	}
+}
+
+func TestCompileRepeatUntilSuccess(t *testing.T) {
+	src := `OPENQASM 3;
+qubit q;
+bit b;
+int n = 0;
+while (b != 1) {
+  reset q;
+  h q;
+  b = measure q;
+  n += 1;
+}
+`
+
+	prog, err := qasm.Compile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qsim := q.New()
+	v, err := prog.Run(qsim)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v["b"] != 1 || v["n"] < 1 {
+		t.Error(v)
+	}
+
+	if qsim.Probability()[1] != 1 {
+		t.Error(qsim.Probability())
+	}
+
+	resets := 0
+	for _, in := range qsim.Circuit().Instructions {
+		if in.Name == "reset" {
+			resets++
+		}
+	}
+
+	if resets != int(v["n"]) {
+		t.Errorf("%v: %v", resets, v["n"])
+	}
+}
+
+func TestCompileModifier(t *testing.T) {
+	src := `OPENQASM 3;
+qubit[3] q;
+gate cxx a, b, c {
+  ctrl @ x a, b;
+  ctrl @ x a, c;
+}
+for i in [0:2] {
+  x q[i];
+}
+ctrl(2) @ x q[0], q[1], q[2];
+negctrl @ x q[2], q[1];
+h q[2];
+pow(2) @ t q[2];
+inv @ s q[2];
+h q[2];
+for int i in {1, 2} {
+  if (i == 2) break;
+  x q[i];
+}
+inv @ cxx q[1], q[0], q[2];
+`
+
+	prog, err := qasm.Compile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qsim := q.New()
+	if _, err := prog.Run(qsim); err != nil {
+		t.Fatal(err)
+	}
+
+	// |111> |110> |100> |100> |110> |011>
+	if math.Abs(qsim.Probability()[3]-1) > 1e-13 {
+		t.Error(qsim.Probability())
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	var test = []struct {
+		src string
+		err string
+	}{
+		{"OPENQASM 3;\nqubit q;\npow(0.5) @ x q;", "line 3: pow: 0.5 is not an integer"},
+		{"OPENQASM 3;\nqubit q;\nbit c;\nc = measure q;\ninv @ c q;", "line 5: undefined gate \"c\""},
+		{"OPENQASM 3;\nint n;\nint n;", "line 3: \"n\" is already declared"},
+		{"OPENQASM 3;\nbreak;", "qasm: break outside of a loop"},
+		{"OPENQASM 3;\nqubit q;\nif (c) x q;", "line 3: undefined variable \"c\""},
+		{"OPENQASM 3;\nqubit q;\ngate g a { ctrl @ g a; }\ng q;", "line 3: undefined gate \"g\" in \"g\""},
+	}
+
+	for _, tt := range test {
+		prog, err := qasm.Compile(tt.src)
+		if err == nil {
+			_, err = prog.Run(q.New())
+		}
+
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%v: %v\n", err, tt.err)
+		}
+	}
+}
+
+func TestRunErr(t *testing.T) {
+	prog, err := qasm.Compile("OPENQASM 3;\nqubit[2] r;\nh r[0];\nt r[1];")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := q.New()
+	failed.H(&q.Qubit{Index: 3})
+	if _, err := prog.Run(failed); !errors.Is(err, q.ErrQubitOutOfRange) {
+		t.Error(err)
+	}
+
+	if _, err := prog.Run(q.New(q.WithStabilizer())); !errors.Is(err, q.ErrNotClifford) || !strings.HasPrefix(err.Error(), "line 4: ") {
+		t.Error(err)
+	}
+}
@@ -1,35 +1,74 @@
 package qubit
 
 import (
+	"errors"
 	"math"
 	"math/cmplx"
 	"math/rand"
-	"time"
 
+	"github.com/axamon/q/internal/parallel"
 	"github.com/axamon/q/matrix"
 	v "github.com/axamon/q/vector"
 )
 
+var (
+	// ErrZeroNorm is returned when the amplitudes are all zero.
+	ErrZeroNorm = errors.New("qubit: amplitudes of zero norm")
+
+	// ErrDimensionMismatch is returned when the number of amplitudes
+	// is not a power of two.
+	ErrDimensionMismatch = errors.New("qubit: number of amplitudes is not a power of two")
+
+	// ErrEntangled is returned when the qubit to trace out is entangled.
+	ErrEntangled = errors.New("qubit: qubit is entangled")
+)
+
 type Qubit struct {
 	v v.Vector
+
+	// rnd is the source of the measurements, nil for the global one.
+	rnd *rand.Rand
+
+	// workers is the number of goroutines of the loops over
+	// the amplitudes, 0 for one per CPU.
+	workers int
 }
 
+// Validate returns an error if the amplitudes are not those of a state
+// New can normalize: their number must be a power of two greater than one
+// and they must not be all zero.
+func Validate(z ...complex128) error {
+	if len(z) < 2 || len(z)&(len(z)-1) != 0 {
+		return ErrDimensionMismatch
+	}
+
+	for _, zi := range z {
+		if zi != 0 {
+			return nil
+		}
+	}
+
+	return ErrZeroNorm
+}
+
+// New returns the qubits of the amplitudes normalized.
+// The amplitudes must satisfy Validate.
 func New(z ...complex128) *Qubit {
 	v := v.Vector{}
 	for _, zi := range z {
 		v = append(v, zi)
 	}
-	q := &Qubit{v}
+	q := &Qubit{v: v}
 	q.Normalize()
 	return q
 }
 
 func Zero(bit ...int) *Qubit {
-	return &Qubit{v.TensorProductN(v.Vector{1, 0}, bit...)}
+	return &Qubit{v: v.TensorProductN(v.Vector{1, 0}, bit...)}
 }
 
 func One(bit ...int) *Qubit {
-	return &Qubit{v.TensorProductN(v.Vector{0, 1}, bit...)}
+	return &Qubit{v: v.TensorProductN(v.Vector{0, 1}, bit...)}
 }
 
 func (q *Qubit) NumberOfBit() int {
@@ -54,8 +93,39 @@ func (q *Qubit) OuterProduct(q0 *Qubit) matrix.Matrix {
 	return q.v.OuterProduct(q0.v)
 }
 
+// Clone returns a copy of the qubits that shares their source of randomness.
 func (q *Qubit) Clone() *Qubit {
-	return &Qubit{q.v.Clone()}
+	return &Qubit{v: q.v.Clone(), rnd: q.rnd, workers: q.workers}
+}
+
+// Rand makes the measurements and the channels of the qubits draw from
+// the source, so that a seeded source gives the same results in every run.
+// A nil source is the global one.
+func (q *Qubit) Rand(src rand.Source) *Qubit {
+	q.rnd = nil
+	if src != nil {
+		q.rnd = rand.New(src)
+	}
+
+	return q
+}
+
+// Workers sets the number of goroutines that apply the gates, compute
+// the probabilities and normalize the amplitudes of registers of at least
+// 2^14 amplitudes. 0 is one per CPU, the default, and 1 runs the loops
+// on the calling goroutine.
+func (q *Qubit) Workers(n int) *Qubit {
+	q.workers = n
+	return q
+}
+
+// float64 returns a random number in [0.0,1.0) from the source of the qubits.
+func (q *Qubit) float64() float64 {
+	if q.rnd == nil {
+		return rand.Float64()
+	}
+
+	return q.rnd.Float64()
 }
 
 func (q *Qubit) Fidelity(q0 *Qubit) float64 {
@@ -92,17 +162,26 @@ func (q *Qubit) TensorProduct(q0 *Qubit) *Qubit {
 }
 
 func (q *Qubit) Apply(m matrix.Matrix) *Qubit {
-	q.v = q.v.Apply(m)
+	q.v = q.v.Apply(m, q.workers)
 	return q
 }
 
 func (q *Qubit) Normalize() *Qubit {
-	var sum float64
-	for _, amp := range q.v {
-		sum = sum + math.Pow(cmplx.Abs(amp), 2)
-	}
-	z := 1 / math.Sqrt(sum)
-	q.v = q.v.Mul(complex(z, 0))
+	sum := parallel.Sum(len(q.v), q.workers, func(lo, hi int) float64 {
+		var sum float64
+		for _, amp := range q.v[lo:hi] {
+			sum = sum + math.Pow(cmplx.Abs(amp), 2)
+		}
+		return sum
+	})
+
+	z := complex(1/math.Sqrt(sum), 0)
+	parallel.For(len(q.v), q.workers, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			q.v[i] = z * q.v[i]
+		}
+	})
+
 	return q
 }
 
@@ -115,11 +194,12 @@ func (q *Qubit) Amplitude() []complex128 {
 }
 
 func (q *Qubit) Probability() []float64 {
-	list := []float64{}
-	for _, amp := range q.v {
-		p := math.Pow(cmplx.Abs(amp), 2)
-		list = append(list, p)
-	}
+	list := make([]float64, len(q.v))
+	parallel.For(len(q.v), q.workers, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			list[i] = math.Pow(cmplx.Abs(q.v[i]), 2)
+		}
+	})
 	return list
 }
 
@@ -128,8 +208,7 @@ func (q *Qubit) Measure(bit ...int) *Qubit {
 		return q.MeasureAt(bit[0])
 	}
 
-	rand.Seed(time.Now().UnixNano())
-	r := rand.Float64()
+	r := q.float64()
 
 	plist := q.Probability()
 	var sum float64
@@ -149,21 +228,13 @@ func (q *Qubit) ProbabilityZeroAt(bit int) ([]int, []float64) {
 	p := []float64{}
 	index := []int{}
 
-	dim := q.v.Dimension()
-	den := int(math.Pow(2, float64(bit+1)))
-	div := dim / den
-
-	for i := 0; i < dim; i++ {
-		p = append(p, q.Probability()[i])
-		index = append(index, i)
-
-		if len(p) == dim/2 {
-			break
-		}
-
-		if (i+1)%div == 0 {
-			i = i + div
+	mask := q.mask(bit)
+	for i, amp := range q.v {
+		if i&mask != 0 {
+			continue
 		}
+		p = append(p, math.Pow(cmplx.Abs(amp), 2))
+		index = append(index, i)
 	}
 
 	return index, p
@@ -173,23 +244,12 @@ func (q *Qubit) ProbabilityOneAt(bit int) ([]int, []float64) {
 	p := []float64{}
 	index := []int{}
 
-	zi, _ := q.ProbabilityZeroAt(bit)
-	one := []int{}
-	for i := range q.v {
-		found := false
-		for _, zii := range zi {
-			if i == zii {
-				found = true
-				break
-			}
+	mask := q.mask(bit)
+	for i, amp := range q.v {
+		if i&mask == 0 {
+			continue
 		}
-		if !found {
-			one = append(one, i)
-		}
-	}
-
-	for _, i := range one {
-		p = append(p, q.Probability()[i])
+		p = append(p, math.Pow(cmplx.Abs(amp), 2))
 		index = append(index, i)
 	}
 
@@ -197,46 +257,220 @@ func (q *Qubit) ProbabilityOneAt(bit int) ([]int, []float64) {
 }
 
 func (q *Qubit) MeasureAt(bit int) *Qubit {
-	index, p := q.ProbabilityZeroAt(bit)
+	mask := q.mask(bit)
 
-	rand.Seed(time.Now().UnixNano())
-	r := rand.Float64()
+	r := q.float64()
 
-	var sum float64
-	for _, pp := range p {
-		sum = sum + pp
-	}
+	sum := parallel.Sum(len(q.v), q.workers, func(lo, hi int) float64 {
+		var sum float64
+		for i := lo; i < hi; i++ {
+			if i&mask == 0 {
+				sum = sum + math.Pow(cmplx.Abs(q.v[i]), 2)
+			}
+		}
+		return sum
+	})
 
+	// the amplitudes where the bit is not the outcome
+	zero := mask
 	if r > sum {
-		for _, i := range index {
-			q.v[i] = complex(0, 0)
+		zero = 0
+	}
+
+	parallel.For(len(q.v), q.workers, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			if i&mask == zero {
+				q.v[i] = complex(0, 0)
+			}
 		}
+	})
 
-		q.Normalize()
+	q.Normalize()
+	if zero == 0 {
 		return One()
 	}
 
-	one := []int{}
-	for i := range q.v {
-		found := false
-		for _, ix := range index {
-			if i == ix {
-				found = true
-				break
+	return Zero()
+}
+
+// ApplyAt applies the 2x2 matrix u to the target bit in place.
+// The amplitudes are updated only where every control bit is |1>,
+// so the 2^n x 2^n matrix of the whole register is never built.
+func (q *Qubit) ApplyAt(u matrix.Matrix, target int, control ...int) *Qubit {
+	t := q.mask(target)
+
+	c := 0
+	for _, ci := range control {
+		c = c | q.mask(ci)
+	}
+
+	// the k-th pair has the index of k with a 0 inserted at the target bit
+	parallel.For(len(q.v)/2, q.workers, func(lo, hi int) {
+		for k := lo; k < hi; k++ {
+			j := (k&^(t-1))<<1 | k&(t-1)
+			if j&c != c {
+				continue
 			}
+
+			a0, a1 := q.v[j], q.v[j+t]
+			q.v[j] = u[0][0]*a0 + u[0][1]*a1
+			q.v[j+t] = u[1][0]*a0 + u[1][1]*a1
 		}
+	})
+
+	return q
+}
+
+// ApplyControlled applies the 2^k x 2^k matrix u to the k target bits
+// in place, target[0] being the most significant bit of u, only where
+// every control bit is |1> and every open control bit is |0>.
+func (q *Qubit) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) *Qubit {
+	off := q.offsets(target)
+	t := off[len(off)-1]
+
+	c, o := 0, 0
+	for _, ci := range control {
+		c = c | q.mask(ci)
+	}
+	for _, oi := range open {
+		o = o | q.mask(oi)
+	}
+
+	parallel.For(len(q.v), q.workers, func(lo, hi int) {
+		a := make([]complex128, len(off))
+		for i := lo; i < hi; i++ {
+			if i&t != 0 || i&c != c || i&o != 0 {
+				continue
+			}
+
+			for x := range off {
+				a[x] = q.v[i|off[x]]
+			}
 
-		if !found {
-			one = append(one, i)
+			for x := range off {
+				sum := complex(0, 0)
+				for y := range off {
+					sum = sum + u[x][y]*a[y]
+				}
+				q.v[i|off[x]] = sum
+			}
+		}
+	})
+
+	return q
+}
+
+// Expectation returns <q|U|q> of the 2^k x 2^k matrix u on the k target bits,
+// target[0] being the most significant bit of u.
+func (q *Qubit) Expectation(u matrix.Matrix, target ...int) complex128 {
+	return q.Clone().ApplyControlled(u, nil, nil, target...).InnerProduct(q)
+}
+
+// ApplyKraus applies one of the 2x2 Kraus operators to the target bit.
+// The operator K is chosen with the probability ||K|q>||^2 and the state
+// is renormalized, which samples a trajectory of the channel.
+func (q *Qubit) ApplyKraus(k []matrix.Matrix, target int) *Qubit {
+	r := q.float64()
+
+	var sum float64
+	var q1 *Qubit
+	for i := range k {
+		q0 := q.Clone().ApplyAt(k[i], target)
+
+		p := Sum(q0.Probability())
+		if p == 0 {
+			continue
+		}
+
+		q1 = q0
+		sum = sum + p
+		if r < sum {
+			break
 		}
 	}
 
-	for _, i := range one {
-		q.v[i] = complex(0, 0)
+	q.v = q1.v
+	return q.Normalize()
+}
+
+// Swap exchanges the two bits in place.
+func (q *Qubit) Swap(b0, b1 int) *Qubit {
+	m0, m1 := q.mask(b0), q.mask(b1)
+	if m0 == m1 {
+		return q
 	}
 
-	q.Normalize()
-	return Zero()
+	parallel.For(len(q.v), q.workers, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			if i&m0 != 0 && i&m1 == 0 {
+				j := i ^ m0 ^ m1
+				q.v[i], q.v[j] = q.v[j], q.v[i]
+			}
+		}
+	})
+
+	return q
+}
+
+// mask returns the index bit of the amplitudes that corresponds to the bit.
+// The bit 0 is the most significant one.
+func (q *Qubit) mask(bit int) int {
+	return 1 << uint(q.NumberOfBit()-1-bit)
+}
+
+// offsets returns the offsets from the index where the target bits are 0
+// of the indices where they take each value, target[0] being the most
+// significant bit. The last offset has all the target bits set.
+func (q *Qubit) offsets(target []int) []int {
+	k := uint(len(target))
+	off := make([]int, 1<<k)
+	for a := range off {
+		for j, t := range target {
+			if a&(1<<(k-1-uint(j))) != 0 {
+				off[a] = off[a] | q.mask(t)
+			}
+		}
+	}
+
+	return off
+}
+
+// PartialTrace returns the state of the other qubits once the bit is traced out.
+// It returns ErrEntangled if the bit is entangled with them,
+// since their state would not be pure.
+func (q *Qubit) PartialTrace(bit int) (*Qubit, error) {
+	mask := q.mask(bit)
+
+	// the amplitudes of the other bits where the bit is 0 and 1
+	a0, a1 := v.Vector{}, v.Vector{}
+	for i, amp := range q.v {
+		if i&mask == 0 {
+			a0 = append(a0, amp)
+			continue
+		}
+		a1 = append(a1, amp)
+	}
+
+	// the bit is not entangled if they are parallel
+	var n0, n1 float64
+	var inner complex128
+	for i := range a0 {
+		n0 = n0 + math.Pow(cmplx.Abs(a0[i]), 2)
+		n1 = n1 + math.Pow(cmplx.Abs(a1[i]), 2)
+		inner = inner + cmplx.Conj(a0[i])*a1[i]
+	}
+
+	if math.Abs(math.Pow(cmplx.Abs(inner), 2)-n0*n1) > 1e-10 {
+		return nil, ErrEntangled
+	}
+
+	rest := a0
+	if n1 > n0 {
+		rest = a1
+	}
+
+	r := &Qubit{v: rest, rnd: q.rnd, workers: q.workers}
+	return r.Normalize(), nil
 }
 
 func TensorProduct(q ...*Qubit) *Qubit {
@@ -2,6 +2,8 @@ package qubit
 
 import (
 	"fmt"
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/axamon/q/gate"
@@ -164,3 +166,176 @@ func TestMeasure(t *testing.T) {
 	}
 
 }
+
+func TestApplyAt(t *testing.T) {
+	var test = []struct {
+		u       matrix.Matrix
+		target  int
+		control []int
+		dense   matrix.Matrix
+	}{
+		{gate.H(), 0, []int{}, matrix.TensorProduct(gate.H(), gate.I(2))},
+		{gate.H(), 2, []int{}, matrix.TensorProduct(gate.I(2), gate.H())},
+		{gate.X(), 2, []int{0}, gate.CNOT(3, 0, 2)},
+		{gate.X(), 0, []int{2}, gate.CNOT(3, 2, 0)},
+		{gate.X(), 1, []int{0, 2}, gate.ControlledNot(3, []int{0, 2}, 1)},
+		{gate.Z(), 2, []int{0}, gate.CZ(3, 0, 2)},
+		{gate.R(3), 1, []int{2}, gate.CR(3, 2, 1, 3)},
+	}
+
+	for _, tt := range test {
+		expected := New(1, 2, 3, 4, 5, 6, 7, 8).Apply(tt.dense)
+		actual := New(1, 2, 3, 4, 5, 6, 7, 8).ApplyAt(tt.u, tt.target, tt.control...)
+
+		if !actual.Equals(expected, 1e-13) {
+			t.Errorf("%v: %v\n", actual, expected)
+		}
+	}
+}
+
+func TestApplyControlled(t *testing.T) {
+	// open controls are controls between two X
+	x0 := matrix.TensorProduct(gate.X(), gate.I(2))
+
+	var test = []struct {
+		u       matrix.Matrix
+		control []int
+		open    []int
+		target  []int
+		dense   matrix.Matrix
+	}{
+		{gate.X(), []int{0, 1}, []int{}, []int{2}, gate.Toffoli()},
+		{gate.Swap(2, 0, 1), []int{0}, []int{}, []int{1, 2}, gate.Fredkin()},
+		{gate.Swap(2, 0, 1), []int{}, []int{0}, []int{1, 2}, x0.Apply(gate.Fredkin()).Apply(x0)},
+		{gate.CNOT(2, 0, 1), []int{}, []int{}, []int{2, 0}, gate.CNOT(3, 2, 0)},
+		{gate.H(), []int{2}, []int{0}, []int{1}, x0.Apply(gate.Controlled(gate.H(), 3, []int{0, 2}, 1)).Apply(x0)},
+	}
+
+	for _, tt := range test {
+		expected := New(1, 2, 3, 4, 5, 6, 7, 8).Apply(tt.dense)
+		actual := New(1, 2, 3, 4, 5, 6, 7, 8).ApplyControlled(tt.u, tt.control, tt.open, tt.target...)
+
+		if !actual.Equals(expected, 1e-13) {
+			t.Errorf("%v: %v\n", actual, expected)
+		}
+	}
+}
+
+func TestSwap(t *testing.T) {
+	expected := New(1, 2, 3, 4, 5, 6, 7, 8).Apply(gate.Swap(3, 0, 2))
+	actual := New(1, 2, 3, 4, 5, 6, 7, 8).Swap(0, 2)
+
+	if !actual.Equals(expected) {
+		t.Errorf("%v: %v\n", actual, expected)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var test = []struct {
+		z   []complex128
+		err error
+	}{
+		{[]complex128{1, 1}, nil},
+		{[]complex128{0, 0, 0, 1i}, nil},
+		{[]complex128{0, 0}, ErrZeroNorm},
+		{[]complex128{1}, ErrDimensionMismatch},
+		{[]complex128{1, 0, 0}, ErrDimensionMismatch},
+	}
+
+	for _, tt := range test {
+		if err := Validate(tt.z...); err != tt.err {
+			t.Errorf("%v: %v", tt.z, err)
+		}
+	}
+}
+
+func TestRand(t *testing.T) {
+	m0, m1 := []string{}, []string{}
+	q0 := New(1, 1, 1, 1).Rand(rand.NewSource(1))
+	q1 := New(1, 1, 1, 1).Rand(rand.NewSource(1))
+	for i := 0; i < 32; i++ {
+		c0, c1 := q0.Clone(), q1.Clone()
+		m0 = append(m0, fmt.Sprint(c0.Measure().Probability()))
+		m1 = append(m1, fmt.Sprint(c1.Measure().Probability()))
+	}
+
+	if fmt.Sprint(m0) != fmt.Sprint(m1) {
+		t.Errorf("%v: %v", m0, m1)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	// above the length the loops are split at
+	n := 15
+	rnd := rand.New(rand.NewSource(1))
+
+	z := make([]complex128, 1<<uint(n))
+	for i := range z {
+		z[i] = complex(rnd.Float64()-0.5, rnd.Float64()-0.5)
+	}
+
+	q0 := New(z...).Workers(1)
+	q1 := New(z...).Workers(4)
+	if !q0.Equals(q1, 1e-13) {
+		t.Fatal("normalize")
+	}
+
+	u := gate.U3(0.3, 0.5, 0.7)
+	for _, q := range []*Qubit{q0, q1} {
+		q.ApplyAt(u, 3).ApplyAt(gate.H(), n-1, 0, 7).Swap(2, 9)
+		q.ApplyControlled(gate.CNOT(2, 0, 1), []int{4}, []int{5}, 6, 1)
+	}
+
+	if !q0.Equals(q1, 1e-13) {
+		t.Error("apply")
+	}
+
+	p0, p1 := q0.Probability(), q1.Probability()
+	for i := range p0 {
+		if math.Abs(p0[i]-p1[i]) > 1e-13 {
+			t.Fatal("probability", i)
+		}
+	}
+
+	q0.Rand(rand.NewSource(2)).MeasureAt(3)
+	q1.Rand(rand.NewSource(2)).MeasureAt(3)
+	if !q0.Equals(q1, 1e-13) {
+		t.Error("measure")
+	}
+}
+
+// bench runs f on registers of 16 to 28 qbits in |0...0>,
+// on the calling goroutine and on one goroutine per CPU.
+func bench(b *testing.B, f func(q *Qubit)) {
+	for _, n := range []int{16, 20, 24, 28} {
+		for _, w := range []int{1, 0} {
+			b.Run(fmt.Sprintf("qbits=%d/workers=%d", n, w), func(b *testing.B) {
+				q := &Qubit{v: make([]complex128, 1<<uint(n)), workers: w}
+				q.v[0] = 1
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					f(q)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkApplyAt(b *testing.B) {
+	h := gate.H()
+	bench(b, func(q *Qubit) { q.ApplyAt(h, 1) })
+}
+
+func BenchmarkApplyControlled(b *testing.B) {
+	u := gate.CNOT(2, 0, 1)
+	bench(b, func(q *Qubit) { q.ApplyControlled(u, []int{0}, nil, 1, 2) })
+}
+
+func BenchmarkProbability(b *testing.B) {
+	bench(b, func(q *Qubit) { q.Probability() })
+}
+
+func BenchmarkNormalize(b *testing.B) {
+	bench(b, func(q *Qubit) { q.Normalize() })
+}
@@ -0,0 +1,178 @@
+package q
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/axamon/q/matrix"
+)
+
+// ClassicalRegister adds a register of size classical bits initialized to 0
+// to the simulator and to its circuit.
+func (q *Q) ClassicalRegister(name string, size int) *Register {
+	if q.circuit.register(name) {
+		q.fail(fmt.Errorf("q: register %q already exists", name))
+		return nil
+	}
+
+	r := Register{Name: name}
+	for i := 0; i < size; i++ {
+		r.Clbit = append(r.Clbit, len(q.clbit))
+		q.clbit = append(q.clbit, 0)
+	}
+
+	if q.circuit.Clbits < len(q.clbit) {
+		q.circuit.Clbits = len(q.clbit)
+	}
+	q.circuit.Registers = append(q.circuit.Registers, r)
+
+	return &r
+}
+
+// register returns true if the circuit has a register of the name.
+func (c *Circuit) register(name string) bool {
+	for _, r := range c.Registers {
+		if r.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MeasureTo measures the qbit into the classical bit, e.g. reg.Clbit[0].
+func (q *Q) MeasureTo(input *Qubit, clbit int) *Q {
+	bit := q.index([]*Qubit{input})
+	if clbit < 0 {
+		q.fail(fmt.Errorf("%w: classical bit %d", ErrQubitOutOfRange, clbit))
+	}
+
+	q.do(Instruction{Name: "measure", Target: bit, Clbit: []int{clbit}})
+	return q
+}
+
+// MeasureRegister measures the qbits into the bits of the register,
+// the first qbit into reg.Clbit[0].
+func (q *Q) MeasureRegister(reg *Register, input ...*Qubit) *Q {
+	if reg == nil || len(input) != len(reg.Clbit) {
+		q.fail(fmt.Errorf("%w: %d qbits measured into a register", ErrDimensionMismatch, len(input)))
+	}
+
+	bit := q.index(input)
+	if q.err != nil {
+		return q
+	}
+
+	q.do(Instruction{Name: "measure", Target: bit, Clbit: append([]int{}, reg.Clbit...)})
+	return q
+}
+
+// Value returns the value of the register. Clbit[0] is the least significant bit.
+func (q *Q) Value(reg *Register) int {
+	v := 0
+	for i, c := range reg.Clbit {
+		if c < len(q.clbit) && q.clbit[c] == 1 {
+			v = v | 1<<uint(i)
+		}
+	}
+
+	return v
+}
+
+// Bitstring returns the bits of the register from the most significant one,
+// e.g. "01" if only Clbit[0] is 1.
+func (q *Q) Bitstring(reg *Register) string {
+	var b strings.Builder
+	for i := len(reg.Clbit) - 1; i > -1; i-- {
+		c := reg.Clbit[i]
+		if c < len(q.clbit) && q.clbit[c] == 1 {
+			b.WriteString("1")
+			continue
+		}
+		b.WriteString("0")
+	}
+
+	return b.String()
+}
+
+// Conditional applies gates only if the classical bits hold a value.
+// The gates are recorded in the circuit with their condition
+// whether they are applied or not, so that the circuit can be replayed.
+type Conditional struct {
+	q         *Q
+	condition *Condition
+}
+
+// IfRegister returns the gates conditioned on the register holding the value,
+// e.g. qsim.IfRegister(reg, 1).X(q0).
+func (q *Q) IfRegister(reg *Register, value int) *Conditional {
+	c := &Condition{Value: value}
+	if reg != nil {
+		c.Clbit = append([]int{}, reg.Clbit...)
+	}
+
+	return &Conditional{q, c}
+}
+
+// apply executes the instruction with the condition on each of the qbits.
+func (c *Conditional) apply(in Instruction, input ...*Qubit) *Q {
+	in.Condition = c.condition
+	return c.q.apply(in, input...)
+}
+
+func (c *Conditional) H(input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "h"}, input...)
+}
+
+func (c *Conditional) X(input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "x"}, input...)
+}
+
+func (c *Conditional) Y(input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "y"}, input...)
+}
+
+func (c *Conditional) Z(input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "z"}, input...)
+}
+
+func (c *Conditional) S(input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "s"}, input...)
+}
+
+func (c *Conditional) T(input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "t"}, input...)
+}
+
+// RX rotates each of the qbits by theta about the x axis.
+func (c *Conditional) RX(theta float64, input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "rx", Params: []float64{theta}}, input...)
+}
+
+// RY rotates each of the qbits by theta about the y axis.
+func (c *Conditional) RY(theta float64, input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "ry", Params: []float64{theta}}, input...)
+}
+
+// RZ rotates each of the qbits by theta about the z axis.
+func (c *Conditional) RZ(theta float64, input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "rz", Params: []float64{theta}}, input...)
+}
+
+// Apply applies the 2x2 matrix to each of the qbits.
+func (c *Conditional) Apply(mat matrix.Matrix, input ...*Qubit) *Q {
+	return c.apply(Instruction{Name: "unitary", Matrix: mat}, input...)
+}
+
+func (c *Conditional) CNOT(control *Qubit, target *Qubit) *Q {
+	ctrl, open := c.q.controls([]*Qubit{control})
+	c.q.do(Instruction{
+		Name:      "x",
+		Target:    c.q.index([]*Qubit{target}),
+		Control:   ctrl,
+		Open:      open,
+		Condition: c.condition,
+	})
+
+	return c.q
+}
@@ -0,0 +1,158 @@
+package q
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/axamon/q/internal/parallel"
+)
+
+// Counts is the number of shots of each bitstring.
+type Counts map[string]int
+
+// Shots returns the total number of shots.
+func (c Counts) Shots() int {
+	n := 0
+	for _, v := range c {
+		n = n + v
+	}
+
+	return n
+}
+
+// Probability returns the frequency of each bitstring.
+func (c Counts) Probability() map[string]float64 {
+	n := float64(c.Shots())
+
+	p := map[string]float64{}
+	for k, v := range c {
+		p[k] = float64(v) / n
+	}
+
+	return p
+}
+
+// String returns the counts sorted by bitstring, e.g. "00:512 11:488".
+func (c Counts) String() string {
+	keys := []string{}
+	for k := range c {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	list := []string{}
+	for _, k := range keys {
+		list = append(list, fmt.Sprintf("%s:%d", k, c[k]))
+	}
+
+	return strings.Join(list, " ")
+}
+
+// Sample measures the qbits in shots copies of the register and returns
+// how many times each bitstring was read. The first qbit is the first
+// character of the bitstring and without input every qbit is read in order.
+// The register is not changed and nothing is recorded in the circuit.
+// The readout errors of the noise model apply.
+// It returns nil if Err is not nil, shots is negative, the register is empty
+// or a qbit is not in the register. Unlike the gates it does not set Err.
+func (q *Q) Sample(shots int, input ...*Qubit) Counts {
+	memory := q.Memory(shots, input...)
+	if memory == nil {
+		return nil
+	}
+
+	c := Counts{}
+	for _, m := range memory {
+		c[m]++
+	}
+
+	return c
+}
+
+// Memory is Sample returning the bitstring of each shot in order.
+func (q *Q) Memory(shots int, input ...*Qubit) []string {
+	if q.err != nil || shots < 0 || q.state.NumberOfBit() == 0 {
+		return nil
+	}
+
+	bit := q.bits()
+	if len(input) > 0 {
+		bit = []int{}
+		for _, in := range input {
+			if in == nil || in.owner != nil && in.owner != q {
+				return nil
+			}
+			bit = append(bit, in.Index)
+		}
+	}
+
+	for _, t := range bit {
+		if t < 0 || t >= len(q.pos) || q.pos[t] < 0 {
+			return nil
+		}
+	}
+
+	memory := make([]string, 0, shots)
+	for _, shot := range q.sample(q.state, shots) {
+		b := make([]byte, len(bit))
+		for j, t := range bit {
+			one := shot[q.pos[t]]
+			if q.misread(t, one) {
+				one = !one
+			}
+
+			b[j] = '0'
+			if one {
+				b[j] = '1'
+			}
+		}
+
+		memory = append(memory, string(b))
+	}
+
+	return memory
+}
+
+// sample returns the bits of shots measurements of the state, by position.
+// Unless the state samples itself they are drawn from the cumulative
+// distribution by binary search, split across the workers.
+func (q *Q) sample(s Backend, shots int) [][]bool {
+	if m, ok := s.(sampler); ok {
+		return m.sample(shots)
+	}
+
+	n := s.NumberOfBit()
+	p := s.Probability()
+
+	cdf := parallel.CumSum(p, q.workers)
+	sum := 0.0
+	if len(cdf) > 0 {
+		sum = cdf[len(cdf)-1]
+	}
+
+	// the random numbers are drawn in order to keep the seeded results
+	r := make([]float64, shots)
+	for i := range r {
+		r[i] = q.float64() * sum
+	}
+
+	out := make([][]bool, shots)
+	parallel.For(shots, q.workers, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			// the first state whose cumulative probability exceeds r
+			k := sort.Search(len(cdf), func(j int) bool { return cdf[j] > r[i] })
+			if k == len(cdf) {
+				k = len(cdf) - 1
+			}
+
+			shot := make([]bool, n)
+			for b := range shot {
+				shot[b] = k&(1<<uint(n-1-b)) != 0
+			}
+			out[i] = shot
+		}
+	})
+
+	return out
+}
@@ -0,0 +1,586 @@
+package q
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"math/rand"
+
+	"github.com/axamon/q/density"
+	"github.com/axamon/q/gate"
+	"github.com/axamon/q/matrix"
+	"github.com/axamon/q/qubit"
+)
+
+// stabilizer is the tableau of the stabilizers and destabilizers of a state
+// reached by Clifford gates, after Aaronson and Gottesman (CHP).
+// Row i < n is a destabilizer, row n+i a stabilizer, each a Pauli string
+// (-1)^r X^x Z^z with one bit of x and z per column packed in words.
+type stabilizer struct {
+	n int
+	x [][]uint64
+	z [][]uint64
+	r []bool
+
+	// col is the column of the qbit at each position. The column
+	// of a released qbit stays in the tableau as |0>.
+	col []int
+
+	src rand.Source
+	rnd *rand.Rand
+}
+
+func get(row []uint64, c int) bool {
+	return row[c>>6]>>uint(c&63)&1 == 1
+}
+
+func flip(row []uint64, c int) {
+	row[c>>6] = row[c>>6] ^ 1<<uint(c&63)
+}
+
+// float64 returns a random number in [0.0,1.0) from the source.
+func (s *stabilizer) float64() float64 {
+	if s.rnd == nil {
+		return rand.Float64()
+	}
+
+	return s.rnd.Float64()
+}
+
+// Add appends a qbit in a stabilizer state such as |0>, |1> or |+>,
+// or returns ErrNotClifford.
+func (s *stabilizer) Add(z ...complex128) error {
+	w, ok := prepare(z)
+	if !ok {
+		return fmt.Errorf("%w: %v is not a stabilizer state", ErrNotClifford, z)
+	}
+
+	c := s.n
+	words := (c + 64) / 64
+	for i := range s.x {
+		for len(s.x[i]) < words {
+			s.x[i] = append(s.x[i], 0)
+			s.z[i] = append(s.z[i], 0)
+		}
+	}
+
+	// the destabilizer X and the stabilizer Z of |0>
+	dx, dz := make([]uint64, words), make([]uint64, words)
+	sx, sz := make([]uint64, words), make([]uint64, words)
+	flip(dx, c)
+	flip(sz, c)
+
+	s.x = append(s.x[:c], append([][]uint64{dx}, s.x[c:]...)...)
+	s.z = append(s.z[:c], append([][]uint64{dz}, s.z[c:]...)...)
+	s.r = append(s.r[:c], append([]bool{false}, s.r[c:]...)...)
+	s.x = append(s.x, sx)
+	s.z = append(s.z, sz)
+	s.r = append(s.r, false)
+	s.n++
+
+	s.col = append(s.col, c)
+	s.word(w, c)
+	return nil
+}
+
+func (s *stabilizer) NumberOfBit() int {
+	return len(s.col)
+}
+
+func (s *stabilizer) ApplyAt(u matrix.Matrix, target int, control ...int) {
+	s.ApplyControlled(u, control, nil, target)
+}
+
+// applyControlled applies a single-qbit Clifford gate, or a Pauli gate
+// with one control. The gate has been checked by supports.
+func (s *stabilizer) ApplyControlled(u matrix.Matrix, control, open []int, target ...int) {
+	t := s.col[target[0]]
+	if len(control)+len(open) == 0 {
+		w, _ := clifford(u)
+		s.word(w, t)
+		return
+	}
+
+	c := 0
+	if len(open) > 0 {
+		c = s.col[open[0]]
+		s.pauli('X', c)
+	} else {
+		c = s.col[control[0]]
+	}
+
+	// the phase of the Pauli gate is a phase gate on the control
+	op, p, _ := asPauli(u)
+	k, _ := quarter(p)
+	for i := 0; i < k; i++ {
+		s.s(c)
+	}
+
+	switch op {
+	case 'X':
+		s.cnot(c, t)
+	case 'Y':
+		s.word("sss", t)
+		s.cnot(c, t)
+		s.s(t)
+	case 'Z':
+		s.h(t)
+		s.cnot(c, t)
+		s.h(t)
+	}
+
+	if len(open) > 0 {
+		s.pauli('X', c)
+	}
+}
+
+// applyKraus applies one of the Pauli operators of the channel
+// with its probability.
+func (s *stabilizer) ApplyKraus(k []matrix.Matrix, target int) {
+	r := s.float64()
+	sum := 0.0
+	for _, m := range k {
+		op, c, _ := asPauli(m)
+		sum = sum + real(c*cmplx.Conj(c))
+		if r < sum {
+			s.pauli(op, s.col[target])
+			return
+		}
+	}
+}
+
+func (s *stabilizer) Swap(b0, b1 int) {
+	s.col[b0], s.col[b1] = s.col[b1], s.col[b0]
+}
+
+func (s *stabilizer) Measure(bit int) bool {
+	return s.measure(s.col[bit])
+}
+
+func (s *stabilizer) Probability() []float64 {
+	return s.vector().Probability()
+}
+
+func (s *stabilizer) DensityMatrix() *density.Matrix {
+	return density.Pure(s.vector())
+}
+
+func (s *stabilizer) Clone() Backend {
+	c := &stabilizer{n: s.n, r: append([]bool{}, s.r...), col: append([]int{}, s.col...), src: s.src, rnd: s.rnd}
+	for i := range s.x {
+		c.x = append(c.x, append([]uint64{}, s.x[i]...))
+		c.z = append(c.z, append([]uint64{}, s.z[i]...))
+	}
+
+	return c
+}
+
+// release resets the qbit to |0> if it is not entangled, that is if X, Y
+// or Z of the qbit commutes with all the stabilizers, and forgets it.
+func (s *stabilizer) Release(bit int) error {
+	c := s.col[bit]
+
+	x, z, y := true, true, true
+	for i := s.n; i < 2*s.n; i++ {
+		xi, zi := get(s.x[i], c), get(s.z[i], c)
+		x, z, y = x && !zi, z && !xi, y && xi == zi
+	}
+
+	switch {
+	case z:
+	case x:
+		s.h(c)
+	case y:
+		s.word("sssh", c)
+	default:
+		return qubit.ErrEntangled
+	}
+
+	if s.measure(c) {
+		s.pauli('X', c)
+	}
+
+	s.col = append(s.col[:bit], s.col[bit+1:]...)
+	return nil
+}
+
+func (s *stabilizer) Expectation(u []matrix.Matrix, target [][]int) complex128 {
+	return (&vector{qubit: s.vector()}).Expectation(u, target)
+}
+
+// sample measures every qbit of a clone of the tableau for each shot.
+func (s *stabilizer) sample(shots int) [][]bool {
+	out := make([][]bool, 0, shots)
+	for i := 0; i < shots; i++ {
+		c := s.Clone().(*stabilizer)
+		shot := make([]bool, len(c.col))
+		for p := range shot {
+			shot[p] = c.measure(c.col[p])
+		}
+		out = append(out, shot)
+	}
+
+	return out
+}
+
+func (s *stabilizer) Rand(src rand.Source) {
+	s.src, s.rnd = src, nil
+	if src != nil {
+		s.rnd = rand.New(src)
+	}
+}
+
+// vector returns the state vector of the qbits, the projection
+// of a basis state of the support by the stabilizers.
+// The released qbits are |0> and not part of it.
+func (s *stabilizer) vector() *qubit.Qubit {
+	n := len(s.col)
+
+	// a measured basis state has a nonzero amplitude, measured with
+	// a source of its own to leave the measurements of the simulator as they are
+	m := s.Clone().(*stabilizer)
+	m.Rand(rand.NewSource(1))
+	b := 0
+	for i := range s.col {
+		if m.measure(m.col[i]) {
+			b = b | 1<<uint(n-1-i)
+		}
+	}
+
+	v := make([]complex128, 1<<uint(n))
+	v[b] = 1
+	for i := s.n; i < 2*s.n; i++ {
+		g := make([]complex128, len(v))
+		for k := range v {
+			if v[k] == 0 {
+				continue
+			}
+
+			// the Pauli string on the basis state k
+			j, a := k, complex(1, 0)
+			if s.r[i] {
+				a = -1
+			}
+			for p, c := range s.col {
+				x, z := get(s.x[i], c), get(s.z[i], c)
+				one := k&(1<<uint(n-1-p)) != 0
+				if z && one {
+					a = -a
+				}
+				if x {
+					j = j ^ 1<<uint(n-1-p)
+				}
+				if x && z {
+					// Y = iXZ
+					a = a * 1i
+				}
+			}
+
+			g[j] = g[j] + a*v[k]
+		}
+
+		for k := range v {
+			v[k] = (v[k] + g[k]) / 2
+		}
+	}
+
+	return qubit.New(v...).Rand(s.src)
+}
+
+// word applies the gates of the word of h and s to the column.
+func (s *stabilizer) word(w string, c int) {
+	for _, g := range w {
+		if g == 'h' {
+			s.h(c)
+			continue
+		}
+		s.s(c)
+	}
+}
+
+func (s *stabilizer) h(a int) {
+	for i := range s.x {
+		x, z := get(s.x[i], a), get(s.z[i], a)
+		if x && z {
+			s.r[i] = !s.r[i]
+		}
+		if x != z {
+			flip(s.x[i], a)
+			flip(s.z[i], a)
+		}
+	}
+}
+
+func (s *stabilizer) s(a int) {
+	for i := range s.x {
+		x, z := get(s.x[i], a), get(s.z[i], a)
+		if x && z {
+			s.r[i] = !s.r[i]
+		}
+		if x {
+			flip(s.z[i], a)
+		}
+	}
+}
+
+func (s *stabilizer) cnot(a, b int) {
+	for i := range s.x {
+		xa, za := get(s.x[i], a), get(s.z[i], a)
+		xb, zb := get(s.x[i], b), get(s.z[i], b)
+		if xa && zb && xb == za {
+			s.r[i] = !s.r[i]
+		}
+		if xa {
+			flip(s.x[i], b)
+		}
+		if zb {
+			flip(s.z[i], a)
+		}
+	}
+}
+
+// pauli applies the Pauli gate X, Y or Z, which only changes the signs.
+func (s *stabilizer) pauli(op byte, a int) {
+	for i := range s.x {
+		x, z := get(s.x[i], a), get(s.z[i], a)
+		if op == 'X' && z || op == 'Z' && x || op == 'Y' && x != z {
+			s.r[i] = !s.r[i]
+		}
+	}
+}
+
+// measure measures the column in the Z basis and returns true for 1.
+func (s *stabilizer) measure(a int) bool {
+	p := -1
+	for i := s.n; i < 2*s.n; i++ {
+		if get(s.x[i], a) {
+			p = i
+			break
+		}
+	}
+
+	if p > -1 {
+		// the stabilizer p anticommutes with Z, the outcome is random
+		for i := range s.x {
+			if i != p && get(s.x[i], a) {
+				s.r[i] = rowsum(s.x[i], s.z[i], s.r[i], s.x[p], s.z[p], s.r[p])
+			}
+		}
+
+		d := p - s.n
+		copy(s.x[d], s.x[p])
+		copy(s.z[d], s.z[p])
+		s.r[d] = s.r[p]
+
+		for w := range s.x[p] {
+			s.x[p][w], s.z[p][w] = 0, 0
+		}
+		flip(s.z[p], a)
+		s.r[p] = s.float64() < 0.5
+		return s.r[p]
+	}
+
+	// Z is a product of the stabilizers of the destabilizers it anticommutes with
+	x, z, r := make([]uint64, len(s.x[0])), make([]uint64, len(s.x[0])), false
+	for i := 0; i < s.n; i++ {
+		if get(s.x[i], a) {
+			r = rowsum(x, z, r, s.x[s.n+i], s.z[s.n+i], s.r[s.n+i])
+		}
+	}
+
+	return r
+}
+
+// rowsum multiplies the row h by the row i and returns the sign of the product.
+func rowsum(hx, hz []uint64, hr bool, ix, iz []uint64, ir bool) bool {
+	sum := 0
+	if hr {
+		sum = sum + 2
+	}
+	if ir {
+		sum = sum + 2
+	}
+
+	for w := range ix {
+		// the exponent of i of the product of the operators of each column
+		both := (ix[w] | iz[w]) & (hx[w] | hz[w])
+		for both != 0 {
+			b := uint(bits.TrailingZeros64(both))
+			both = both & (both - 1)
+
+			x1, z1 := int(ix[w]>>b&1), int(iz[w]>>b&1)
+			x2, z2 := int(hx[w]>>b&1), int(hz[w]>>b&1)
+			switch {
+			case x1 == 1 && z1 == 1:
+				sum = sum + z2 - x2
+			case x1 == 1:
+				sum = sum + z2*(2*x2-1)
+			default:
+				sum = sum + x2*(1-2*z2)
+			}
+		}
+
+		hx[w] = hx[w] ^ ix[w]
+		hz[w] = hz[w] ^ iz[w]
+	}
+
+	return (sum%4+4)%4 == 2
+}
+
+// Validate returns ErrNotClifford if the instruction is not a Clifford
+// operation: a single-qbit Clifford gate, a Pauli gate with one control,
+// a swap, a measurement, a reset or a Pauli channel.
+func (s *stabilizer) Validate(in Instruction) error {
+	switch in.Name {
+	case "measure", "reset", "barrier":
+		return nil
+	case "kraus":
+		for _, k := range in.Kraus {
+			if _, _, ok := asPauli(k); !ok {
+				return fmt.Errorf("%w: %v", ErrNotClifford, in.Name)
+			}
+		}
+		return nil
+	case "swap":
+		if len(in.Control)+len(in.Open) > 0 {
+			return fmt.Errorf("%w: c%v", ErrNotClifford, in.Name)
+		}
+		return nil
+	case "qft", "iqft":
+		if len(in.Target) > 1 {
+			return fmt.Errorf("%w: %v", ErrNotClifford, in.Name)
+		}
+		return nil
+	}
+
+	u := in.Unitary()
+	if u == nil {
+		return nil
+	}
+
+	ok := false
+	switch {
+	case len(u) != 2:
+	case len(in.Control)+len(in.Open) == 0:
+		_, ok = clifford(u)
+	case len(in.Control)+len(in.Open) == 1:
+		_, c, p := asPauli(u)
+		_, k := quarter(c)
+		ok = p && k
+	}
+
+	if !ok {
+		name := in.Name
+		if len(in.Control)+len(in.Open) > 0 {
+			name = "c" + name
+		}
+		return fmt.Errorf("%w: %v", ErrNotClifford, name)
+	}
+
+	return nil
+}
+
+// cliffordWord is a single-qbit Clifford gate as a word of h and s.
+type cliffordWord struct {
+	word string
+	u    matrix.Matrix
+}
+
+// cliffords are the 24 single-qbit Clifford gates up to a global phase.
+var cliffords = func() []cliffordWord {
+	list := []cliffordWord{{"", gate.I()}}
+	for i := 0; i < len(list); i++ {
+		for _, g := range []string{"h", "s"} {
+			m := gate.H()
+			if g == "s" {
+				m = gate.S()
+			}
+
+			u := list[i].u.Apply(m)
+			if _, ok := match(u, list); !ok {
+				list = append(list, cliffordWord{list[i].word + g, u})
+			}
+		}
+	}
+
+	return list
+}()
+
+// clifford returns the word of the Clifford gate equal to u up to a phase.
+func clifford(u matrix.Matrix) (string, bool) {
+	return match(u, cliffords)
+}
+
+// match returns the word of the gate of the list equal to u up to a phase.
+func match(u matrix.Matrix, list []cliffordWord) (string, bool) {
+	for _, c := range list {
+		// the phase is the ratio of the first nonzero elements
+		var p complex128
+		for i := 0; i < 4 && p == 0; i++ {
+			if cmplx.Abs(c.u[i/2][i%2]) > 1e-10 {
+				p = u[i/2][i%2] / c.u[i/2][i%2]
+			}
+		}
+
+		if math.Abs(cmplx.Abs(p)-1) < 1e-10 && u.Equals(c.u.Mul(p), 1e-10) {
+			return c.word, true
+		}
+	}
+
+	return "", false
+}
+
+// prepare returns the word of the Clifford gate that turns |0>
+// into the state of the amplitudes, if it is a stabilizer state.
+func prepare(z []complex128) (string, bool) {
+	norm := cmplx.Abs(z[0])*cmplx.Abs(z[0]) + cmplx.Abs(z[1])*cmplx.Abs(z[1])
+	for _, c := range cliffords {
+		overlap := cmplx.Conj(z[0])*c.u[0][0] + cmplx.Conj(z[1])*c.u[1][0]
+		if math.Abs(cmplx.Abs(overlap)*cmplx.Abs(overlap)-norm) < 1e-10*norm {
+			return c.word, true
+		}
+	}
+
+	return "", false
+}
+
+// asPauli returns the Pauli operator P and the coefficient c of u = cP.
+func asPauli(u matrix.Matrix) (byte, complex128, bool) {
+	if r, c := u.Dimension(); r != 2 || c != 2 {
+		return 0, 0, false
+	}
+
+	for _, op := range []byte("IXYZ") {
+		var m matrix.Matrix
+		switch op {
+		case 'I':
+			m = gate.I()
+		case 'X':
+			m = gate.X()
+		case 'Y':
+			m = gate.Y()
+		case 'Z':
+			m = gate.Z()
+		}
+
+		// c = Tr(Pu)/2
+		c := (m[0][0]*u[0][0] + m[0][1]*u[1][0] + m[1][0]*u[0][1] + m[1][1]*u[1][1]) / 2
+		if cmplx.Abs(c) > 1e-10 && u.Equals(m.Mul(c), 1e-10) {
+			return op, c, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// quarter returns k if the phase is i^k.
+func quarter(phase complex128) (int, bool) {
+	for k, p := range []complex128{1, 1i, -1, -1i} {
+		if cmplx.Abs(phase-p) < 1e-10 {
+			return k, true
+		}
+	}
+
+	return 0, false
+}
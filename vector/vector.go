@@ -3,6 +3,7 @@ package vector
 import (
 	"math/cmplx"
 
+	"github.com/axamon/q/internal/parallel"
 	"github.com/axamon/q/matrix"
 )
 
@@ -121,18 +122,27 @@ func (v0 Vector) IsUnit() bool {
 }
 
 // Apply returns the vector resulting from multiplying the vector by the matrix.
-func (v0 Vector) Apply(mat matrix.Matrix) Vector {
-	v := Vector{}
-
+// The rows of large matrices are split across the optional number of
+// goroutines, one per CPU by default.
+func (v0 Vector) Apply(mat matrix.Matrix, workers ...int) Vector {
 	m, _ := mat.Dimension()
-	for i := 0; i < m; i++ {
-		tmp := complex(0, 0)
-		for j := 0; j < len(v0); j++ {
-			tmp = tmp + mat[i][j]*v0[j]
-		}
-		v = append(v, tmp)
+	v := make(Vector, m)
+
+	w := 0
+	if len(workers) > 0 {
+		w = workers[0]
 	}
 
+	parallel.Rows(m, len(v0), w, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			tmp := complex(0, 0)
+			for j := 0; j < len(v0); j++ {
+				tmp = tmp + mat[i][j]*v0[j]
+			}
+			v[i] = tmp
+		}
+	})
+
 	return v
 }
 